@@ -0,0 +1,267 @@
+package gpk
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/build"
+	"go/types"
+	"io"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var ErrIncompatibleAPI = errors.New("the API has incompatible changes since the last version tag, a major step is required")
+
+// APIChange is a difference of an exported identifier between two versions of a package
+type APIChange struct {
+	// Name is the name of the identifier like in IdentUsage
+	Name string
+
+	// Compatible is false, if the change may break importers
+	Compatible bool
+
+	// Message describes the change, e.g. "removed"
+	Message string
+}
+
+func (a APIChange) String() string {
+	compat := "incompatible"
+	if a.Compatible {
+		compat = "compatible"
+	}
+	return fmt.Sprintf("%s: %s (%s)", a.Name, a.Message, compat)
+}
+
+// APIDiff are the API changes between two versions of a package, sorted by name
+type APIDiff []APIChange
+
+// Incompatible returns the incompatible changes
+func (d APIDiff) Incompatible() APIDiff {
+	var inc APIDiff
+	for _, c := range d {
+		if !c.Compatible {
+			inc = append(inc, c)
+		}
+	}
+	return inc
+}
+
+type apiChanges []APIChange
+
+func (a apiChanges) Len() int           { return len(a) }
+func (a apiChanges) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a apiChanges) Less(i, j int) bool { return a[i].Name < a[j].Name }
+
+// apiEntry is the comparable description of an exported identifier
+type apiEntry struct {
+	kind string
+	desc string
+
+	// inInterface is true for the methods of interfaces
+	inInterface bool
+}
+
+// apiEntries returns the entries of the exported identifiers of pkg by name.
+// Types are qualified by the full package paths, so that the entries of
+// different type-checks of the same package are comparable.
+func apiEntries(pkg *types.Package) map[string]apiEntry {
+	qualifier := func(p *types.Package) string { return p.Path() }
+	entries := map[string]apiEntry{}
+
+	for obj, u := range exportedIdents(pkg) {
+		e := apiEntry{kind: u.Kind}
+		switch o := obj.(type) {
+		case *types.Const:
+			e.desc = types.TypeString(o.Type(), qualifier) + " = " + o.Val().ExactString()
+		case *types.TypeName:
+			// fields and methods are entries on their own
+			switch under := o.Type().Underlying().(type) {
+			case *types.Struct:
+				e.desc = "struct"
+			case *types.Interface:
+				e.desc = "interface"
+			default:
+				e.desc = types.TypeString(under, qualifier)
+			}
+		case *types.Func:
+			// the receiver is not part of the type string
+			sig := o.Type().(*types.Signature)
+			if recv := sig.Recv(); recv != nil {
+				e.inInterface = types.IsInterface(recv.Type())
+			}
+			e.desc = types.TypeString(unnamedSignature(sig), qualifier)
+		default:
+			e.desc = types.TypeString(o.Type(), qualifier)
+		}
+		entries[u.Name] = e
+	}
+	return entries
+}
+
+// unnamedSignature returns sig without the receiver and the names of the
+// parameters and results, since renaming them does not change the API
+func unnamedSignature(sig *types.Signature) *types.Signature {
+	unnamed := func(t *types.Tuple) *types.Tuple {
+		vars := make([]*types.Var, t.Len())
+		for i := range vars {
+			v := t.At(i)
+			vars[i] = types.NewVar(v.Pos(), v.Pkg(), "", v.Type())
+		}
+		return types.NewTuple(vars...)
+	}
+	return types.NewSignature(nil, unnamed(sig.Params()), unnamed(sig.Results()), sig.Variadic())
+}
+
+// diffAPI compares the exported API of two versions of a package
+func diffAPI(old, new *types.Package) APIDiff {
+	var (
+		oldEntries = apiEntries(old)
+		newEntries = apiEntries(new)
+		diff       APIDiff
+	)
+
+	for name, o := range oldEntries {
+		n, has := newEntries[name]
+		switch {
+		case !has:
+			diff = append(diff, APIChange{Name: name, Message: "removed"})
+		case o.kind != n.kind:
+			diff = append(diff, APIChange{Name: name, Message: fmt.Sprintf("changed from %s to %s", o.kind, n.kind)})
+		case o.desc != n.desc:
+			diff = append(diff, APIChange{Name: name, Message: fmt.Sprintf("changed from %s to %s", o.desc, n.desc)})
+		}
+	}
+
+	for name, n := range newEntries {
+		if _, has := oldEntries[name]; has {
+			continue
+		}
+		// implementations of an interface don't have an added method
+		diff = append(diff, APIChange{Name: name, Message: "added", Compatible: !n.inInterface})
+	}
+
+	sort.Sort(apiChanges(diff))
+	return diff
+}
+
+// gitTreeFiles returns the contents of the go files of the package inside dir at
+// the given revision, that match the build constraints, mapped by their paths below dir.
+// Test files are skipped.
+func gitTreeFiles(dir, rev string) (map[string][]byte, error) {
+	prefix, err := gitCmd(dir, "rev-parse", "--show-prefix")
+	if err != nil {
+		return nil, err
+	}
+
+	names, err := gitLines(dir, "ls-tree", "--name-only", rev+":"+prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	files := map[string][]byte{}
+	for _, name := range names {
+		if path.Ext(name) != ".go" || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		content, err := gitCmd(dir, "show", rev+":"+prefix+name)
+		if err != nil {
+			return nil, err
+		}
+		files[filepath.Join(dir, name)] = []byte(content + "\n")
+	}
+
+	ctxt := build.Default
+	ctxt.OpenFile = func(p string) (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(files[p])), nil
+	}
+
+	for p := range files {
+		match, err := ctxt.MatchFile(dir, filepath.Base(p))
+		if err != nil {
+			return nil, err
+		}
+		if !match {
+			delete(files, p)
+		}
+	}
+	return files, nil
+}
+
+// checkAPI type-checks the given files of the package inside dir as pkgPath
+func checkAPI(s *sourceImporter, pkgPath, dir string, files []string) (*types.Package, error) {
+	pkg, errs := s.check(pkgPath, dir, files, nil)
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("%s does not type-check: %s", pkgPath, errs[0])
+	}
+	return pkg, nil
+}
+
+// CompareAPI compares the exported API of the package inside dir at the last
+// version tag with the API of the working tree. tag is empty, if there is no version tag.
+func CompareAPI(dir string) (tag string, diff APIDiff, err error) {
+	var (
+		pkg      *build.Package
+		pkgPath  string
+		tags     []string
+		prefix   string
+		oldFiles map[string][]byte
+		oldPkg   *types.Package
+		newPkg   *types.Package
+	)
+
+steps:
+	for jump := 1; err == nil; jump++ {
+		switch jump - 1 {
+		default:
+			break steps
+		case 0:
+			pkg, err = Pkg(dir)
+		case 1:
+			pkgPath, err = PkgPath(pkg)
+			pkgPath = filepath.ToSlash(pkgPath)
+		case 2:
+			tags, prefix, err = packageTags(dir, "")
+		case 3:
+			if tag, _ = lastVersionTag(tags, prefix); tag == "" {
+				break steps
+			}
+		case 4:
+			oldFiles, err = gitTreeFiles(pkg.Dir, tag)
+		case 5:
+			var names []string
+			for p := range oldFiles {
+				names = append(names, filepath.Base(p))
+			}
+			sort.Strings(names)
+			oldPkg, err = checkAPI(newSourceImporter(oldFiles), pkgPath, pkg.Dir, names)
+		case 6:
+			newPkg, err = checkAPI(newSourceImporter(nil), pkgPath, pkg.Dir, append(pkg.GoFiles, pkg.CgoFiles...))
+		case 7:
+			diff = diffAPI(oldPkg, newPkg)
+		}
+	}
+	return
+}
+
+// CheckStep returns the incompatible API changes since the last version tag and
+// ErrIncompatibleAPI, if there are some and the step of the given level is not major
+func CheckStep(dir string, level int) (APIDiff, error) {
+	if level == 0 {
+		return nil, nil
+	}
+
+	_, diff, err := CompareAPI(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	inc := diff.Incompatible()
+	if len(inc) > 0 {
+		return inc, ErrIncompatibleAPI
+	}
+	return nil, nil
+}
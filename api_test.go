@@ -0,0 +1,87 @@
+package gpk
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"strings"
+	"testing"
+)
+
+func checkSource(t *testing.T, src string) *types.Package {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "a.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pkg, err := (&types.Config{}).Check("a", fset, []*ast.File{f}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pkg
+}
+
+func TestDiffAPI(t *testing.T) {
+	old := checkSource(t, `package a
+
+const C = 1
+
+func F(int) {}
+func G()    {}
+func H(x int, s ...string) (n int, err error) { return }
+
+type T struct{ X int }
+
+func (T) M() {}
+
+type I interface{ N() }
+`)
+
+	new := checkSource(t, `package a
+
+const C = 1
+
+func F(string) {}
+func H(y int, rest ...string) (int, error) { return 0, nil }
+
+type T struct {
+	X int
+	Y string
+	y int
+}
+
+func (T) M()  {}
+func (*T) P() {}
+
+type I interface {
+	N()
+	O()
+}
+
+var V int
+`)
+
+	var got []string
+	for _, c := range diffAPI(old, new) {
+		got = append(got, c.String())
+	}
+
+	expected := []string{
+		"F: changed from func(int) to func(string) (incompatible)",
+		"G: removed (incompatible)",
+		"I.O: added (incompatible)",
+		"T.P: added (compatible)",
+		"T.Y: added (compatible)",
+		"V: added (compatible)",
+	}
+
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("diffAPI() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(expected, "\n"))
+	}
+
+	if inc := diffAPI(old, new).Incompatible(); len(inc) != 3 {
+		t.Errorf("len(Incompatible()) = %d; want 3", len(inc))
+	}
+}
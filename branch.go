@@ -0,0 +1,168 @@
+package gpk
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// majorBranch returns the name of the branch of the major version with the
+// given tag prefix, e.g. v2 or sub/v2, that gopkg.in prefers over the tags
+func majorBranch(prefix string, version [3]int) string {
+	return fmt.Sprintf("%sv%d", prefix, version[0])
+}
+
+// revision returns the commit of rev inside dir or an empty string, if it does not exist
+func revision(dir, rev string) string {
+	sha1, err := gitCmd(dir, "rev-parse", "--verify", "--quiet", rev+"^{commit}")
+	if err != nil {
+		return ""
+	}
+	return sha1
+}
+
+// updateMajorBranch creates the given branch of a major version at the commit rev,
+// or HEAD if rev is empty, or fast-forwards it to the commit. It returns the step
+// that restores the branch.
+func (p *Pusher) updateMajorBranch(dir, branch, rev string) (*undoStep, error) {
+	if rev == "" {
+		rev = "HEAD"
+	}
+
+	var (
+		ref  = "refs/heads/" + branch
+		head = revision(dir, rev)
+		old  = revision(dir, ref)
+	)
+
+	switch {
+	case head == "":
+		return nil, fmt.Errorf("can't find %s", rev)
+	case old == head:
+		return nil, nil
+	case old != "":
+		if _, err := gitCmd(dir, "merge-base", "--is-ancestor", old, head); err != nil {
+			return nil, fmt.Errorf("can't fast-forward branch %s to %s", branch, rev)
+		}
+	}
+
+	// update-ref checks that the branch has not moved in the meantime
+	if _, err := gitCmd(dir, "update-ref", ref, head, old); err != nil {
+		return nil, err
+	}
+
+	undo := &undoStep{desc: "update of local branch " + branch}
+	undo.fn = func() error {
+		if old == "" {
+			_, err := gitCmd(dir, "update-ref", "-d", ref, head)
+			return err
+		}
+		_, err := gitCmd(dir, "update-ref", ref, old, head)
+		return err
+	}
+	return undo, nil
+}
+
+// pushMajorBranch pushes the given branch of a major version to the remote.
+// Non fast-forward updates are refused by the remote. If RollbackRemote is set,
+// it returns the step that restores the remote branch.
+func (p *Pusher) pushMajorBranch(dir, remote, branch string) (*undoStep, error) {
+	ref := "refs/heads/" + branch
+
+	out, err := gitCmd(dir, "ls-remote", remote, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	var old string
+	if fields := strings.Fields(out); len(fields) > 0 {
+		old = fields[0]
+	}
+
+	if _, err = gitCmd(dir, "push", remote, ref+":"+ref); err != nil || !p.RollbackRemote {
+		return nil, err
+	}
+
+	undo := &undoStep{desc: "update of branch " + branch + " on " + remote}
+	undo.fn = func() error {
+		lease := "--force-with-lease=" + ref + ":" + revision(dir, ref)
+		if old == "" {
+			_, err := gitCmd(dir, "push", lease, remote, ":"+ref)
+			return err
+		}
+		_, err := gitCmd(dir, "push", lease, remote, old+":"+ref)
+		return err
+	}
+	return undo, nil
+}
+
+// BranchStatus compares the branch of the major version of the last version tag
+// with the tag
+type BranchStatus struct {
+	Branch string
+	Tag    string
+
+	// Ahead is the number of commits of the branch that the tag does not have
+	Ahead int
+
+	// Behind is the number of commits of the tag that the branch does not have
+	Behind int
+}
+
+// Diverged returns true, if the branch does not contain the tag, so that
+// gopkg.in serves a version without the tagged commits
+func (b *BranchStatus) Diverged() bool {
+	return b.Behind > 0
+}
+
+func (b *BranchStatus) String() string {
+	if b.Ahead > 0 && b.Behind > 0 {
+		return fmt.Sprintf("branch %s and tag %s have diverged: %d commits only on the branch, %d only on the tag", b.Branch, b.Tag, b.Ahead, b.Behind)
+	}
+	if b.Behind > 0 {
+		return fmt.Sprintf("branch %s is %d commits behind tag %s", b.Branch, b.Behind, b.Tag)
+	}
+	if b.Ahead > 0 {
+		return fmt.Sprintf("branch %s is %d commits ahead of tag %s", b.Branch, b.Ahead, b.Tag)
+	}
+	return fmt.Sprintf("branch %s is at tag %s", b.Branch, b.Tag)
+}
+
+// MajorBranchStatus compares the last version tag of the package inside dir with
+// the branch of its major version. It returns nil, if there is no version tag
+// or no such branch.
+func MajorBranchStatus(dir string) (*BranchStatus, error) {
+	tags, prefix, err := packageTags(dir, "")
+	if err != nil {
+		return nil, err
+	}
+
+	tag, version := lastVersionTag(tags, prefix)
+	if tag == "" {
+		return nil, nil
+	}
+
+	b := &BranchStatus{Branch: majorBranch(prefix, version), Tag: tag}
+	if revision(dir, "refs/heads/"+b.Branch) == "" {
+		return nil, nil
+	}
+
+	// the counts of the commits that only the branch and only the tag have
+	counts, err := gitCmd(dir, "rev-list", "--left-right", "--count", "refs/heads/"+b.Branch+"..."+tag+"^{commit}")
+	if err != nil {
+		return nil, err
+	}
+
+	fields := strings.Fields(counts)
+	if len(fields) != 2 {
+		return nil, fmt.Errorf("unexpected output of git rev-list: %s", counts)
+	}
+
+	if b.Ahead, err = strconv.Atoi(fields[0]); err != nil {
+		return nil, err
+	}
+	if b.Behind, err = strconv.Atoi(fields[1]); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
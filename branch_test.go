@@ -0,0 +1,69 @@
+package gpk
+
+import (
+	"os"
+	"testing"
+)
+
+func TestBranchStatus(t *testing.T) {
+	tests := []struct {
+		ahead, behind int
+		diverged      bool
+		expected      string
+	}{
+		{0, 0, false, "branch v1 is at tag v1.2"},
+		{2, 0, false, "branch v1 is 2 commits ahead of tag v1.2"},
+		{0, 1, true, "branch v1 is 1 commits behind tag v1.2"},
+		{2, 1, true, "branch v1 and tag v1.2 have diverged: 2 commits only on the branch, 1 only on the tag"},
+	}
+
+	for _, test := range tests {
+		b := &BranchStatus{Branch: "v1", Tag: "v1.2", Ahead: test.ahead, Behind: test.behind}
+		if b.Diverged() != test.diverged {
+			t.Errorf("Diverged() for %d/%d = %v; want %v", test.ahead, test.behind, b.Diverged(), test.diverged)
+		}
+		if got := b.String(); got != test.expected {
+			t.Errorf("String() = %#v; want %#v", got, test.expected)
+		}
+	}
+
+	if got, want := majorBranch("", [3]int{2, 1, 0}), "v2"; got != want {
+		t.Errorf("majorBranch() = %#v; want %#v", got, want)
+	}
+}
+
+func TestUpdateMajorBranch(t *testing.T) {
+	dir := tempRepo(t, map[string]string{"a.go": "package a\n"})
+	defer os.RemoveAll(dir)
+
+	p := &Pusher{}
+	first := revision(dir, "HEAD")
+	if _, err := p.updateMajorBranch(dir, "v1", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	second := commitFile(t, dir, "a.go", "package a // 2\n", "fix: 2")
+	undo, err := p.updateMajorBranch(dir, "v1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revision(dir, "v1") != second {
+		t.Fatalf("branch v1 has not been fast-forwarded")
+	}
+
+	if err = undo.fn(); err != nil || revision(dir, "v1") != first {
+		t.Fatalf("undo must restore branch v1, got %v", err)
+	}
+
+	// a commit that does not contain the branch
+	gitRun(t, dir, "update-ref", "refs/heads/v1", second)
+	gitRun(t, dir, "checkout", "-q", "--detach", first)
+	commitFile(t, dir, "a.go", "package a // other\n", "fix: other")
+
+	if _, err = p.updateMajorBranch(dir, "v1", ""); err == nil {
+		t.Errorf("updateMajorBranch() = nil; want the non fast-forward update refused")
+	}
+	if revision(dir, "v1") != second {
+		t.Errorf("branch v1 must not be changed by a refused update")
+	}
+}
@@ -0,0 +1,217 @@
+package gpk
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// ChangelogGroup are the commits of a changelog section having the same type
+type ChangelogGroup struct {
+	// Title is the heading of the group, e.g. "Features"
+	Title   string
+	Commits []Commit
+}
+
+// ChangelogSection are the commits between two revisions, grouped by their type
+type ChangelogSection struct {
+	// Version is the heading of the section, i.e. the tag of the revision To
+	Version string
+	From    string
+	To      string
+
+	// Date is the commit date of To, like 2006-01-02
+	Date   string
+	Groups []ChangelogGroup
+}
+
+// changelogTitles are the titles of the groups of the conventional commit types,
+// breaking changes have their own group
+var changelogTitles = map[string]string{
+	"feat":     "Features",
+	"fix":      "Bug Fixes",
+	"perf":     "Performance",
+	"refactor": "Refactoring",
+	"docs":     "Documentation",
+	"test":     "Tests",
+	"build":    "Build",
+	"ci":       "CI",
+	"chore":    "Chores",
+	"":         "Other Changes",
+}
+
+// changelogOrder is the order of the groups, groups of other types follow alphabetically
+var changelogOrder = []string{"Breaking Changes", "Features", "Bug Fixes", "Performance"}
+
+type changelogGroups []ChangelogGroup
+
+func (c changelogGroups) Len() int      { return len(c) }
+func (c changelogGroups) Swap(i, j int) { c[i], c[j] = c[j], c[i] }
+func (c changelogGroups) Less(i, j int) bool {
+	a, b := c.rank(i), c.rank(j)
+	if a == b {
+		return c[i].Title < c[j].Title
+	}
+	return a < b
+}
+
+func (c changelogGroups) rank(i int) int {
+	if c[i].Title == changelogTitles[""] {
+		return len(changelogOrder) + 1
+	}
+	for r, title := range changelogOrder {
+		if c[i].Title == title {
+			return r
+		}
+	}
+	return len(changelogOrder)
+}
+
+// groupCommits groups the commits by their type, keeping their order
+func groupCommits(commits []Commit) []ChangelogGroup {
+	var (
+		groups  changelogGroups
+		indexes = map[string]int{}
+	)
+
+	for _, c := range commits {
+		title, has := changelogTitles[c.Type]
+		switch {
+		case c.Level == 0:
+			title = "Breaking Changes"
+		case !has:
+			title = c.Type
+		}
+
+		i, has := indexes[title]
+		if !has {
+			i = len(groups)
+			indexes[title] = i
+			groups = append(groups, ChangelogGroup{Title: title})
+		}
+		groups[i].Commits = append(groups[i].Commits, c)
+	}
+
+	sort.Sort(groups)
+	return groups
+}
+
+// Markdown renders the section as markdown
+func (s *ChangelogSection) Markdown() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "## %s", s.Version)
+	if s.Date != "" {
+		fmt.Fprintf(&buf, " (%s)", s.Date)
+	}
+	fmt.Fprintln(&buf)
+
+	for _, g := range s.Groups {
+		fmt.Fprintf(&buf, "\n### %s\n\n%s", g.Title, g.Markdown())
+	}
+	return buf.String()
+}
+
+// Markdown renders the commits of the group as a markdown list
+func (g ChangelogGroup) Markdown() string {
+	var buf bytes.Buffer
+	for _, c := range g.Commits {
+		fmt.Fprintf(&buf, "- %s (%.7s)\n", c.Subject, c.Hash)
+	}
+	return buf.String()
+}
+
+// Summary renders the groups as plain text for messages like the one of a release tag
+func (s *ChangelogSection) Summary() string {
+	var buf bytes.Buffer
+	for i, g := range s.Groups {
+		if i > 0 {
+			fmt.Fprintln(&buf)
+		}
+		fmt.Fprintf(&buf, "%s:\n%s", g.Title, g.Markdown())
+	}
+	return buf.String()
+}
+
+// changelogSection returns the section for the commits between from and to,
+// headed by version
+func changelogSection(dir, version, from, to string) (*ChangelogSection, error) {
+	commits, err := commitsBetween(dir, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	date, err := gitCmd(dir, "log", "-1", "--format=%cd", "--date=short", to)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ChangelogSection{
+		Version: version,
+		From:    from,
+		To:      to,
+		Date:    date,
+		Groups:  groupCommits(commits),
+	}, nil
+}
+
+// Changelog returns the changelog section for the commits of the repo inside dir
+// between the revisions from and to. If to is empty, it is the last version tag.
+// If from is empty, it is the version tag before to, or the first commit, if there is none.
+func Changelog(dir, from, to string) (*ChangelogSection, error) {
+	tags, prefix, err := packageTags(dir, "")
+	if err != nil {
+		return nil, err
+	}
+
+	vt := sortedVersionTags(tags, prefix)
+
+	if to == "" {
+		if len(vt) == 0 {
+			return nil, ErrNoVersionTag
+		}
+		to = vt[len(vt)-1].tag
+	}
+
+	if from == "" {
+		for i, t := range vt {
+			if t.tag == to && i > 0 {
+				from = vt[i-1].tag
+			}
+		}
+	}
+
+	return changelogSection(dir, to, from, to)
+}
+
+// changelogChange returns the change that prepends the section of the given tag for
+// the commits since the last version tag to the changelog file of the Rewriter inside dir
+func (r *Rewriter) changelogChange(dir, tag string) (*FileChange, error) {
+	tags, prefix, err := packageTags(dir, "")
+	if err != nil {
+		return nil, err
+	}
+
+	since, _ := lastVersionTag(tags, prefix)
+	section, err := changelogSection(dir, tag, since, "HEAD")
+	if err != nil {
+		return nil, err
+	}
+
+	file := filepath.Join(dir, r.Changelog)
+	original, err := ioutil.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	replaced := []byte(section.Markdown())
+	if len(original) > 0 {
+		replaced = append(append(replaced, '\n'), original...)
+	}
+
+	f := newFileChange(dir, file, original, replaced, 0)
+	f.Category = TextFile
+	return f, nil
+}
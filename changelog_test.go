@@ -0,0 +1,46 @@
+package gpk
+
+import (
+	"testing"
+)
+
+func TestChangelogMarkdown(t *testing.T) {
+	commits := []Commit{
+		{Hash: "1111111111", Subject: "fix: a", Type: "fix", Level: 2},
+		{Hash: "2222222222", Subject: "update readme", Level: 2},
+		{Hash: "3333333333", Subject: "feat: b", Type: "feat", Level: 1},
+		{Hash: "4444444444", Subject: "style: c", Type: "style", Level: 2},
+		{Hash: "5555555555", Subject: "feat!: d", Type: "feat", Level: 0},
+		{Hash: "6666666666", Subject: "fix: e", Type: "fix", Level: 2},
+	}
+
+	s := &ChangelogSection{Version: "v1.2", Date: "2014-05-01", Groups: groupCommits(commits)}
+
+	expected := `## v1.2 (2014-05-01)
+
+### Breaking Changes
+
+- feat!: d (5555555)
+
+### Features
+
+- feat: b (3333333)
+
+### Bug Fixes
+
+- fix: a (1111111)
+- fix: e (6666666)
+
+### style
+
+- style: c (4444444)
+
+### Other Changes
+
+- update readme (2222222)
+`
+
+	if got := s.Markdown(); got != expected {
+		t.Errorf("Markdown() =\n%s\nwant\n%s", got, expected)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"go/build"
 	"gopkg.in/go-on/gpk.v1"
@@ -15,6 +16,7 @@ import (
 commands:
 
 dependents // show packages inside the dir that depend on the given package
+versions // lists the version tags
 last_version // shows the last version by tags
 
 */
@@ -30,28 +32,86 @@ var (
 		config.Shortflag('d'),
 	)
 
-	verbose = cfg.NewBool("verbose", "verbose messages", config.Shortflag('v'))
+	verbose        = cfg.NewBool("verbose", "verbose messages", config.Shortflag('v'))
+	dryRun         = cfg.NewBool("dry-run", "show the changes as diffs without writing them")
+	importComments = cfg.NewBool("import-comments", "add import comments to packages without one on develop and release")
+	files          = cfg.NewString("files", "comma separated globs of non go files where develop and release rewrite the package path, e.g. *.md,.travis.yml")
+	verify         = cfg.NewBool("verify", "type-check the rewritten packages and report the ones that don't compile")
+	rollback       = cfg.NewBool("rollback", "with --verify: write nothing if a rewritten package does not type-check")
 
-	develop = cfg.MustCommand("develop", "switch package to github repo in order to develop")
+	develop          = cfg.MustCommand("develop", "switch package to github repo in order to develop")
+	developWorkspace = develop.NewString("workspace", "workspace file listing the package dirs of repos that are developed together")
+
+	undevelop          = cfg.MustCommand("undevelop", "switch back the paths that have been switched by develop")
+	undevelopWorkspace = undevelop.NewString("workspace", "workspace file listing the package dirs of repos that are developed together")
+
+	fork         = cfg.MustCommand("fork", "redirect the imports of an upstream package and its gopkg.in variants to a fork")
+	forkUpstream = fork.NewString("upstream", "the upstream package", config.Required)
+	forkTarget   = fork.NewString("fork", "the fork of the upstream package", config.Required)
+
+	unfork         = cfg.MustCommand("unfork", "restore the imports that have been redirected to a fork")
+	unforkUpstream = unfork.NewString("upstream", "the upstream package", config.Required)
+
+	status = cfg.MustCommand("status", "show whether the package is in develop mode")
 
 	replace       = cfg.MustCommand("replace", "replace an import with another")
-	replaceSrc    = replace.NewString("src", "the import that should be replaced", config.Required)
-	replaceTarget = replace.NewString("target", "the replacement for the import", config.Required)
+	replaceSrc    = replace.NewString("src", "the import that should be replaced")
+	replaceTarget = replace.NewString("target", "the replacement for the import")
+	replaceMap    = replace.NewString("map", "file with lines of imports and their replacements, separated by whitespace")
 
 	release     = cfg.MustCommand("release", "change pkg import paths to release tag")
-	releaseStep = release.NewString("step", "step that should be upped, available options are: minor|major|patch",
+	releaseStep = release.NewString("step", "step that should be upped, available options are: minor|major|patch|auto (suggested by conventional commits)",
 		config.Required,
 		config.Default("patch"),
 		config.Shortflag('s'),
 	)
+	releaseChangelog = release.NewBool("changelog", "prepend a section with the commits since the last version tag to CHANGELOG.md")
+	releaseMessage   = release.NewString("message", "text/template of the message of the commit of the rewritten files with the fields .Version, .Date and .Changelog", config.Default(gpk.DefaultReleaseMessage))
+	releaseForce     = release.NewBool("force", "release a minor or patch step even if the API has incompatible changes since the last version tag")
+
 	push     = cfg.MustCommand("push", "tag the version and push it")
-	pushStep = push.NewString("step", "step that should be upped, available options are: minor|major|patch",
+	pushStep = push.NewString("step", "step that should be upped, available options are: minor|major|patch|auto (suggested by conventional commits)",
 		config.Required,
 		config.Default("patch"),
 		config.Shortflag('s'),
 	)
-	imports = cfg.MustCommand("imports", "show imported packages excluding stdlib packages")
-	deps    = cfg.MustCommand("deps", "show packages inside the given dir that depends packages of the repo")
+	pushMessage        = push.NewString("message", "text/template of the tag message with the fields .Version, .Date and .Changelog", config.Default(gpk.DefaultTagMessage))
+	pushSign           = push.NewBool("sign", "sign the tag with the signing key of the git configuration")
+	pushRemotes        = push.NewString("remote", "comma separated remotes that must accept the push, defaults to the git config gpk.remote or the remote of the branch")
+	pushMirrors        = push.NewString("mirror", "comma separated remotes that the push is mirrored to, failures are only reported (git config gpk.mirror)")
+	pushMajorBranch    = push.NewBool("major-branch", "create or fast-forward the branch of the major version, e.g. v2, to the tagged commit and push it")
+	pushRef            = push.NewString("ref", "branch or commit to tag instead of HEAD, e.g. a maintenance branch; the version follows the last version tag reachable from it")
+	pushRollbackRemote = push.NewBool("rollback-remote", "delete the pushed tag from the remote too, if the push or the installation fails")
+	pushGates          = push.NewString("gates", "comma separated gates that must pass before tagging, in order: clean,upstream,develop,vet,test",
+		config.Default("clean,upstream,develop,vet,test"),
+	)
+
+	verifyTag    = cfg.MustCommand("verify-tag", "verify the signature of a release tag")
+	verifyTagTag = verifyTag.NewString("tag", "the tag to verify, defaults to the last version tag")
+
+	changelog       = cfg.MustCommand("changelog", "show the commits between two revisions, grouped by their conventional commit type")
+	changelogFrom   = changelog.NewString("from", "start revision (exclusive), defaults to the version tag before --to")
+	changelogTo     = changelog.NewString("to", "end revision, defaults to the last version tag")
+	changelogFormat = changelog.NewString("format", "output format: markdown|json", config.Default("markdown"))
+
+	api = cfg.MustCommand("api", "show the changes of the exported API since the last version tag")
+
+	suggest = cfg.MustCommand("suggest", "suggest the step of the next release by the conventional commits since the last version tag")
+
+	versions = cfg.MustCommand("versions", "list the version tags with their commits and dates, flagging invalid tags, skipped versions and duplicates")
+
+	lastVersion       = cfg.MustCommand("last_version", "show the last version tag")
+	lastVersionFormat = lastVersion.NewString("format", "output format: plain|json", config.Default("plain"))
+
+	recoverCmd  = cfg.MustCommand("recover", "finish an interrupted rewrite or undo it")
+	recoverUndo = recoverCmd.NewBool("undo", "restore the original files instead of finishing the rewrite")
+
+	imports   = cfg.MustCommand("imports", "show imported packages excluding stdlib packages")
+	deps      = cfg.MustCommand("deps", "show packages inside the given dir that depends packages of the repo, also via test files and files excluded by build constraints")
+	depsSites = deps.NewBool("sites", "show every import of the packages of the repo with file, line, column, alias and whether it is in a test file")
+
+	usage    = cfg.MustCommand("usage", "show the exported identifiers of a package that are used by the packages inside the given dir")
+	usagePkg = usage.NewString("pkg", "import path of the used package, defaults to the package inside the given dir")
 )
 
 func reportError(err error) {
@@ -62,6 +122,167 @@ func reportError(err error) {
 	}
 }
 
+func rewriter() *gpk.Rewriter {
+	return &gpk.Rewriter{
+		DryRun:            dryRun.Get(),
+		AddImportComments: importComments.Get(),
+		Verify:            verify.Get(),
+		RollbackOnError:   rollback.Get(),
+		Globs:             splitList(files.Get()),
+	}
+}
+
+// remotes returns the remotes of the --remote and --mirror flags. The configured
+// required remotes and mirrors are used for missing flags.
+func remotes() ([]gpk.Remote, error) {
+	configured, err := gpk.ConfiguredRemotes(getDir())
+	if err != nil {
+		return nil, err
+	}
+
+	flags := map[bool][]string{
+		true:  splitList(pushRemotes.Get()),
+		false: splitList(pushMirrors.Get()),
+	}
+
+	var rs []gpk.Remote
+	for _, required := range []bool{true, false} {
+		if len(flags[required]) == 0 {
+			for _, r := range configured {
+				if r.Required == required {
+					rs = append(rs, r)
+				}
+			}
+			continue
+		}
+		for _, name := range flags[required] {
+			rs = append(rs, gpk.Remote{Name: name, Required: required})
+		}
+	}
+	return rs, nil
+}
+
+// splitList returns the non empty trimmed items of a comma separated list
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// printUsage prints the used identifiers with their positions, followed by the unused ones
+func printUsage(report *gpk.UsageReport) {
+	fmt.Fprintf(os.Stdout, "used identifiers of %s:\n", report.Package)
+	for _, u := range report.Used {
+		fmt.Fprintf(os.Stdout, "%s (%s): %d\n", u.Name, u.Kind, len(u.Positions))
+		for _, pos := range u.Positions {
+			fmt.Fprintf(os.Stdout, "\t%s\n", pos)
+		}
+	}
+	fmt.Fprintf(os.Stdout, "unused identifiers of %s:\n", report.Package)
+	for _, u := range report.Unused {
+		fmt.Fprintf(os.Stdout, "%s (%s)\n", u.Name, u.Kind)
+	}
+}
+
+// printSuggestion prints the suggested step and the commits that decided it
+func printSuggestion(s *gpk.StepSuggestion) {
+	since := s.Since
+	if since == "" {
+		since = "the first commit"
+	}
+	fmt.Fprintf(os.Stdout, "suggested step since %s: %s\n", since, s.Step)
+	for _, c := range s.Commits {
+		fmt.Fprintf(os.Stdout, "\t%.7s %s\n", c.Hash, c.Subject)
+	}
+}
+
+// stepFor returns the step, or the suggested step for the release of ref if it is auto
+func stepFor(step, ref string) string {
+	if step != "auto" {
+		return step
+	}
+	s, err := gpk.SuggestStepAt(getDir(), ref)
+	reportError(err)
+	printSuggestion(s)
+	return s.Step
+}
+
+// checkStep refuses a minor or patch step, if the API has incompatible changes
+func checkStep(step string) {
+	level, err := gpk.StepLevel(step)
+	if err != nil {
+		return
+	}
+	inc, err := gpk.CheckStep(getDir(), level)
+	for _, c := range inc {
+		fmt.Fprintln(os.Stderr, c)
+	}
+	if err == gpk.ErrIncompatibleAPI {
+		err = fmt.Errorf("%s, use --step=major or --force", err)
+	}
+	reportError(err)
+}
+
+// printChanges prints the changed files with their categories,
+// for a dry run preceded by the diffs and followed by a summary
+func printChanges(changes gpk.Changes) {
+	if dryRun.Get() {
+		fmt.Fprint(os.Stdout, changes.Diff())
+	}
+	for _, f := range changes {
+		fmt.Fprintf(os.Stdout, "%s (%s, %d import sites)\n", f.Name, f.Category, f.Sites)
+	}
+	if dryRun.Get() {
+		fmt.Fprintf(os.Stdout, "%s would be changed (dry run, nothing written)\n", changes.Summary())
+	}
+}
+
+func printStatus(dir string) error {
+	files, err := gpk.Interrupted(dir)
+	if err != nil {
+		return err
+	}
+	if len(files) > 0 {
+		fmt.Fprintf(os.Stdout, "interrupted rewrite of %d files, run gpk recover\n", len(files))
+	}
+
+	branch, err := gpk.MajorBranchStatus(dir)
+	if err != nil {
+		return err
+	}
+	if branch != nil && branch.Diverged() {
+		fmt.Fprintln(os.Stdout, branch)
+	}
+
+	forks, err := gpk.Forks(dir)
+	if err != nil {
+		return err
+	}
+	for upstream, f := range forks {
+		fmt.Fprintf(os.Stdout, "%s is redirected to %s in %d files, run gpk unfork\n", upstream, f.Fork, len(f.Files))
+	}
+
+	state, err := gpk.DevelopStatus(dir)
+	if err != nil {
+		return err
+	}
+	if state == nil {
+		fmt.Fprintln(os.Stdout, "not in develop mode")
+		return nil
+	}
+
+	var paths int
+	for _, sw := range state.Files {
+		paths += len(sw)
+	}
+	fmt.Fprintf(os.Stdout, "develop mode: %d paths switched to %s in %d files, run gpk undevelop\n", paths, strings.Join(state.Packages, ", "), len(state.Files))
+	return nil
+}
+
 func getDir() string {
 	d := dir.Get()
 	a, err := filepath.Abs(d)
@@ -80,7 +301,87 @@ func main() {
 
 	switch cfg.ActiveCommand() {
 	case replace:
-		err = gpk.ReplaceImport(getDir(), replaceSrc.Get(), replaceTarget.Get())
+		var changes gpk.Changes
+		switch {
+		case replaceMap.Get() != "":
+			var m gpk.ImportMap
+			m, err = gpk.ReadImportMap(replaceMap.Get())
+			reportError(err)
+			var reports []gpk.MappingReport
+			changes, reports, err = rewriter().ReplaceImports(getDir(), m)
+			reportError(err)
+			for _, rep := range reports {
+				fmt.Fprintln(os.Stdout, rep)
+			}
+		case replaceSrc.Get() != "" && replaceTarget.Get() != "":
+			changes, err = rewriter().ReplaceImport(getDir(), replaceSrc.Get(), replaceTarget.Get())
+		default:
+			err = fmt.Errorf("either --map or --src and --target are required")
+		}
+		reportError(err)
+		printChanges(changes)
+	case changelog:
+		var section *gpk.ChangelogSection
+		section, err = gpk.Changelog(getDir(), changelogFrom.Get(), changelogTo.Get())
+		reportError(err)
+		switch changelogFormat.Get() {
+		case "markdown":
+			fmt.Fprint(os.Stdout, section.Markdown())
+		case "json":
+			var data []byte
+			data, err = json.MarshalIndent(section, "", "  ")
+			reportError(err)
+			fmt.Fprintln(os.Stdout, string(data))
+		default:
+			err = fmt.Errorf("unsupported format: %s", changelogFormat.Get())
+		}
+	case verifyTag:
+		var out string
+		out, err = gpk.VerifyTag(getDir(), verifyTagTag.Get())
+		reportError(err)
+		fmt.Fprint(os.Stdout, out)
+	case api:
+		var tag string
+		var diff gpk.APIDiff
+		tag, diff, err = gpk.CompareAPI(getDir())
+		reportError(err)
+		if tag == "" {
+			fmt.Fprintln(os.Stdout, "no version tag")
+			break
+		}
+		fmt.Fprintf(os.Stdout, "API changes since %s:\n", tag)
+		for _, c := range diff {
+			fmt.Fprintln(os.Stdout, c)
+		}
+	case suggest:
+		var s *gpk.StepSuggestion
+		s, err = gpk.SuggestStep(getDir())
+		reportError(err)
+		printSuggestion(s)
+	case versions:
+		var vs []gpk.Version
+		vs, err = gpk.Versions(getDir())
+		reportError(err)
+		for _, v := range vs {
+			fmt.Fprintln(os.Stdout, v)
+		}
+	case lastVersion:
+		var v *gpk.Version
+		v, err = gpk.LatestVersion(getDir())
+		reportError(err)
+		switch lastVersionFormat.Get() {
+		case "plain":
+			fmt.Fprintln(os.Stdout, v.Tag)
+		case "json":
+			var data []byte
+			data, err = json.MarshalIndent(v, "", "  ")
+			reportError(err)
+			fmt.Fprintln(os.Stdout, string(data))
+		default:
+			err = fmt.Errorf("unsupported format: %s", lastVersionFormat.Get())
+		}
+	case recoverCmd:
+		err = gpk.Recover(getDir(), recoverUndo.Get())
 	case imports:
 		var imps []string
 		imps, err = gpk.ExtImports(getDir())
@@ -94,49 +395,131 @@ func main() {
 		path, err = gpk.PkgPath(p)
 		// fmt.Println(path)
 		reportError(err)
+		if depsSites.Get() {
+			var sites []gpk.ImportSite
+			sites, err = gpk.ImportSites(getDir(), path)
+			reportError(err)
+			for _, site := range sites {
+				fmt.Fprintln(os.Stdout, site)
+			}
+			break
+		}
 		var depends []string
 		//depends, err = gpk.DependentsPrefix(getDir(), filepath.Join(p.SrcRoot, path))
 		depends, err = gpk.DependentsPrefix(getDir(), path)
 		reportError(err)
 		fmt.Fprintln(os.Stdout, strings.Join(depends, "\n"))
+	case usage:
+		path := usagePkg.Get()
+		if path == "" {
+			var p *build.Package
+			p, err = gpk.Pkg(getDir())
+			reportError(err)
+			path, err = gpk.PkgPath(p)
+			reportError(err)
+		}
+		var report *gpk.UsageReport
+		report, err = gpk.Usage(getDir(), path)
+		reportError(err)
+		printUsage(report)
 	case develop:
-		err = gpk.ReplaceWithGithubPath(getDir())
+		var changes gpk.Changes
+		if developWorkspace.Get() != "" {
+			var ws *gpk.Workspace
+			ws, err = gpk.ReadWorkspace(developWorkspace.Get())
+			reportError(err)
+			changes, err = rewriter().DevelopWorkspace(ws)
+		} else {
+			changes, err = rewriter().ReplaceWithGithubPath(getDir())
+		}
+		reportError(err)
+		printChanges(changes)
+	case undevelop:
+		var changes gpk.Changes
+		if undevelopWorkspace.Get() != "" {
+			var ws *gpk.Workspace
+			ws, err = gpk.ReadWorkspace(undevelopWorkspace.Get())
+			reportError(err)
+			changes, err = rewriter().UndevelopWorkspace(ws)
+		} else {
+			changes, err = rewriter().Undevelop(getDir())
+		}
+		reportError(err)
+		printChanges(changes)
+	case fork:
+		var changes gpk.Changes
+		changes, err = rewriter().Fork(getDir(), forkUpstream.Get(), forkTarget.Get())
+		reportError(err)
+		printChanges(changes)
+	case unfork:
+		var changes gpk.Changes
+		changes, err = rewriter().Unfork(getDir(), unforkUpstream.Get())
+		reportError(err)
+		printChanges(changes)
+	case status:
+		err = printStatus(getDir())
 	case release:
 		var version [3]int
-		switch releaseStep.Get() {
+		var changes gpk.Changes
+		step := stepFor(releaseStep.Get(), "")
+		if !releaseForce.Get() {
+			checkStep(step)
+		}
+		r := rewriter()
+		r.ReleaseMessage = releaseMessage.Get()
+		if releaseChangelog.Get() {
+			r.Changelog = "CHANGELOG.md"
+		}
+		switch step {
 		case "major":
-			version, err = gpk.SetNewMajor(getDir())
+			version, changes, err = r.SetNewMajor(getDir())
 		case "minor":
-			version, err = gpk.SetNewMinor(getDir())
+			version, changes, err = r.SetNewMinor(getDir())
 		case "patch":
-			version, err = gpk.SetNewPatch(getDir())
+			version, changes, err = r.SetNewPatch(getDir())
 		default:
-			err = fmt.Errorf("unsupported step: %s", releaseStep.Get())
+			err = fmt.Errorf("unsupported step: %s", step)
 			// report error here
 		}
 
 		var changedVersion [3]int
 		changedVersion[0] = version[0]
-		if err == nil {
+		reportError(err)
+		printChanges(changes)
+		if !dryRun.Get() {
 			fmt.Fprintf(
 				os.Stdout,
-				"changed pkg imports to: %s (for %s)\nDon't forget to run gpk push --step=%s\n",
+				"changed pkg imports to: %s (for %s) and committed them\nDon't forget to run gpk push --step=%s\n",
 				gpk.VersionString(changedVersion),
 				gpk.VersionString(version),
-				releaseStep.Get(),
+				step,
 			)
 		}
 	case push:
 		var version [3]int
-		switch pushStep.Get() {
+		step := stepFor(pushStep.Get(), pushRef.Get())
+		p := &gpk.Pusher{
+			Message:        pushMessage.Get(),
+			Sign:           pushSign.Get(),
+			RollbackRemote: pushRollbackRemote.Get(),
+			MajorBranch:    pushMajorBranch.Get(),
+			Ref:            pushRef.Get(),
+			Report:         func(res gpk.GateResult) { fmt.Fprintln(os.Stdout, res) },
+			ReportPush:     func(res gpk.PushResult) { fmt.Fprintln(os.Stdout, res) },
+		}
+		p.Remotes, err = remotes()
+		reportError(err)
+		p.Gates, err = gpk.GatesByName(splitList(pushGates.Get())...)
+		reportError(err)
+		switch step {
 		case "major":
-			version, err = gpk.PushNewMajor(getDir())
+			version, err = p.PushNewMajor(getDir())
 		case "minor":
-			version, err = gpk.PushNewMinor(getDir())
+			version, err = p.PushNewMinor(getDir())
 		case "patch":
-			version, err = gpk.PushNewPatch(getDir())
+			version, err = p.PushNewPatch(getDir())
 		default:
-			err = fmt.Errorf("unsupported step: %s", pushStep.Get())
+			err = fmt.Errorf("unsupported step: %s", step)
 			// report error here
 		}
 
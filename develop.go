@@ -0,0 +1,435 @@
+package gpk
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DevelopFile is the name of the file inside the package dir that tracks
+// the paths that have been rewritten by develop
+const DevelopFile = ".gpk-develop"
+
+var ErrNotInDevelopMode = errors.New("package is not in develop mode")
+
+// PathSwitch is a single path that has been rewritten by develop
+type PathSwitch struct {
+	Original string
+	Replaced string
+
+	// Index is the number of the whole occurrences of Replaced inside the
+	// rewritten file before the rewritten path
+	Index int
+}
+
+// addedCommentPrefix is the text before the path of an import comment,
+// that has been added by develop. Such comments have an empty Original.
+const addedCommentPrefix = ` // import "`
+
+// DevelopState records, which paths have been rewritten in which files by develop
+type DevelopState struct {
+	// Packages are the github paths of the switched packages
+	Packages []string
+
+	// Files maps the paths of the rewritten files relative to the package dir
+	// to their rewritten paths
+	Files map[string][]PathSwitch
+}
+
+// pathTokenEnd returns the end of the path that starts at start, including subpackages
+func pathTokenEnd(in []byte, start int) int {
+	end := start
+	for end < len(in) && (in[end] == '/' || isPathChar(in[end])) && !(in[end] == '.' && pathEnds(in, end)) {
+		end++
+	}
+	return end
+}
+
+// pathSite is a full path inside a file that starts at start
+type pathSite struct {
+	start int
+	path  string
+}
+
+// pathSites returns every full path inside in that starts with path.
+// If versioned is true, path is a bare gopkg.in path that is followed by any version.
+func pathSites(in []byte, path string, versioned bool) []pathSite {
+	var (
+		sites  []pathSite
+		needle = []byte(path)
+	)
+
+	if versioned {
+		needle = []byte(path + ".v")
+	}
+
+	for i := 0; i < len(in); {
+		idx := bytes.Index(in[i:], needle)
+		if idx == -1 {
+			break
+		}
+		start := i + idx
+		end := start + len(needle)
+		i = start + 1
+
+		if start > 0 && isPathChar(in[start-1]) {
+			continue
+		}
+
+		if versioned {
+			l := matchVersion(in[end:])
+			if l == 0 {
+				continue
+			}
+			end += l
+		}
+
+		if !pathEnds(in, end) {
+			continue
+		}
+
+		end = pathTokenEnd(in, start)
+		sites = append(sites, pathSite{start, string(in[start:end])})
+		i = end
+	}
+	return sites
+}
+
+// occurrences returns the starts of the whole occurrences of path inside in,
+// subpackages of path are not included
+func occurrences(in []byte, path string) []int {
+	var starts []int
+	for i := 0; i < len(in); {
+		idx := bytes.Index(in[i:], []byte(path))
+		if idx == -1 {
+			break
+		}
+		start := i + idx
+		i = start + 1
+
+		if start > 0 && isPathChar(in[start-1]) || pathTokenEnd(in, start) != start+len(path) {
+			continue
+		}
+		starts = append(starts, start)
+	}
+	return starts
+}
+
+// indexSwitches sets the Index of the switches. starts are the starts of the
+// switched paths inside the original content. The order of the occurrences of
+// the same path is not changed by the rewrite, so the index is the number of
+// occurrences of Replaced that have been inside the original before the switched
+// path plus the switches to Replaced before it.
+func indexSwitches(original []byte, sw []PathSwitch, starts []int) {
+	existing := map[string][]int{}
+	for i := range sw {
+		r := sw[i].Replaced
+		if _, has := existing[r]; !has {
+			existing[r] = occurrences(original, r)
+		}
+
+		sw[i].Index = 0
+		for _, start := range existing[r] {
+			if start < starts[i] {
+				sw[i].Index++
+			}
+		}
+		for j := range sw {
+			if sw[j].Replaced == r && starts[j] < starts[i] {
+				sw[i].Index++
+			}
+		}
+	}
+}
+
+// appendSwitches appends the switches of a further rewrite of a file to the
+// switches of the file and shifts the indexes of the earlier switches behind the added ones
+func appendSwitches(sw []PathSwitch, added []PathSwitch) []PathSwitch {
+	for i := range sw {
+		var indexes []int
+		for _, a := range added {
+			if a.Replaced == sw[i].Replaced {
+				indexes = append(indexes, a.Index)
+			}
+		}
+		sort.Ints(indexes)
+		for _, idx := range indexes {
+			if idx <= sw[i].Index {
+				sw[i].Index++
+			}
+		}
+	}
+	return append(sw, added...)
+}
+
+// switches returns the path switches of a change made by develop. Paths that
+// are still inside the replaced content have not been switched, unquoted paths
+// are the ones that remain, since only the quoted paths of go files are rewritten.
+func (f *FileChange) switches(gopkgin, pkgPath string) []PathSwitch {
+	remaining := map[string]int{}
+	for _, s := range pathSites(f.Replaced, gopkgin, true) {
+		remaining[s.path]++
+	}
+
+	sites := pathSites(f.Original, gopkgin, true)
+	kept := map[int]bool{}
+	for _, quoted := range []bool{false, true} {
+		for _, s := range sites {
+			isQuoted := s.start > 0 && f.Original[s.start-1] == '"'
+			if isQuoted == quoted && remaining[s.path] > 0 {
+				remaining[s.path]--
+				kept[s.start] = true
+			}
+		}
+	}
+
+	var (
+		sw     []PathSwitch
+		starts []int
+	)
+	for _, s := range sites {
+		if kept[s.start] {
+			continue
+		}
+		rest := s.path[len(gopkgin)+2:]
+		rest = rest[matchVersion([]byte(rest)):]
+		sw = append(sw, PathSwitch{Original: s.path, Replaced: pkgPath + rest})
+		starts = append(starts, s.start)
+	}
+	indexSwitches(f.Original, sw, starts)
+
+	if added := f.addedComment(pkgPath); added != nil {
+		sw = appendSwitches(sw, []PathSwitch{*added})
+	}
+	return sw
+}
+
+// addedComment returns the switch of the import comment with a path of pkgPath,
+// that the change has added, or nil
+func (f *FileChange) addedComment(pkgPath string) *PathSwitch {
+	if importCommentRegexp.Match(f.Original) {
+		return nil
+	}
+
+	loc := importCommentRegexp.FindIndex(f.Replaced)
+	if loc == nil {
+		return nil
+	}
+
+	// the path is inside the quotes at the end of the clause
+	clause := f.Replaced[loc[0]:loc[1]]
+	start := loc[0] + bytes.IndexByte(clause, '"') + 1
+	p := string(f.Replaced[start : loc[1]-1])
+	if p != pkgPath && !strings.HasPrefix(p, pkgPath+"/") {
+		return nil
+	}
+
+	sw := &PathSwitch{Replaced: p}
+	for _, s := range occurrences(f.Replaced, p) {
+		if s < start {
+			sw.Index++
+		}
+	}
+	return sw
+}
+
+func developPath(dir string) string {
+	return filepath.Join(dir, DevelopFile)
+}
+
+// ReadDevelopState returns the develop state of the package inside dir
+// or ErrNotInDevelopMode
+func ReadDevelopState(dir string) (*DevelopState, error) {
+	data, err := ioutil.ReadFile(developPath(dir))
+	if os.IsNotExist(err) {
+		return nil, ErrNotInDevelopMode
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var s DevelopState
+	err = json.Unmarshal(data, &s)
+	return &s, err
+}
+
+// recordDevelop adds the switches of the changes to the develop state file inside dir.
+// repls are the replacements of the gopkg.in paths by the github paths.
+func recordDevelop(dir string, repls []replaceFile, c Changes) error {
+	s, err := ReadDevelopState(dir)
+	if err == ErrNotInDevelopMode {
+		s, err = &DevelopState{Files: map[string][]PathSwitch{}}, nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, repl := range repls {
+		if !inSlice(s.Packages, repl.target) {
+			s.Packages = append(s.Packages, repl.target)
+		}
+	}
+
+	for _, f := range c {
+		name := filepath.ToSlash(f.Name)
+		for _, repl := range repls {
+			s.Files[name] = appendSwitches(s.Files[name], f.switches(repl.gopkgin, repl.target))
+		}
+	}
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(developPath(dir), data, 0644)
+}
+
+// undoSite is the position of a path that is restored by undoSwitches
+type undoSite struct {
+	start, end int
+	original   string
+}
+
+type undoSites []undoSite
+
+func (u undoSites) Len() int           { return len(u) }
+func (u undoSites) Swap(i, j int)      { u[i], u[j] = u[j], u[i] }
+func (u undoSites) Less(i, j int) bool { return u[i].start < u[j].start }
+
+// undoSwitches restores the original paths of the given switches inside a file
+type undoSwitches []PathSwitch
+
+func (u undoSwitches) replaceInFile(in []byte) ([]byte, int, error) {
+	var (
+		sites undoSites
+		taken = map[int]bool{}
+		found = map[string][]int{}
+	)
+
+	for _, sw := range u {
+		starts, has := found[sw.Replaced]
+		if !has {
+			starts = occurrences(in, sw.Replaced)
+			found[sw.Replaced] = starts
+		}
+
+		// the switch at Index, switches recorded without index
+		// take the next free occurrence
+		ok := false
+		for i := sw.Index; i < len(starts); i++ {
+			if taken[starts[i]] {
+				continue
+			}
+			site := undoSite{starts[i], starts[i] + len(sw.Replaced), sw.Original}
+
+			// import comments added by develop are removed
+			if sw.Original == "" {
+				site.start -= len(addedCommentPrefix)
+				site.end++
+				if site.start < 0 || site.end > len(in) || string(in[site.start:starts[i]]) != addedCommentPrefix || in[site.end-1] != '"' {
+					break
+				}
+			}
+
+			taken[starts[i]] = true
+			sites = append(sites, site)
+			ok = true
+			break
+		}
+		if !ok {
+			return nil, 0, fmt.Errorf("missing %s, that has been rewritten by develop", sw.Replaced)
+		}
+	}
+
+	sort.Sort(sites)
+
+	var (
+		out  []byte
+		last int
+	)
+	for _, st := range sites {
+		out = append(out, in[last:st.start]...)
+		out = append(out, st.original...)
+		last = st.end
+	}
+	return append(out, in[last:]...), len(sites), nil
+}
+
+// Undevelop restores the paths that have been rewritten by ReplaceWithGithubPath
+// inside the package dir and leaves develop mode
+func Undevelop(pkgDir string) error {
+	_, err := (&Rewriter{}).Undevelop(pkgDir)
+	return err
+}
+
+// Undevelop is like the function Undevelop but returns the changes.
+// It fails without writing anything, if a file does not contain the
+// paths that have been rewritten anymore.
+func (r *Rewriter) Undevelop(pkgDir string) (c Changes, err error) {
+	var (
+		s     *DevelopState
+		names []string
+	)
+
+steps:
+	for jump := 1; err == nil; jump++ {
+		switch jump - 1 {
+		default:
+			break steps
+		case 0:
+			s, err = ReadDevelopState(pkgDir)
+		case 1:
+			for name := range s.Files {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+
+			for _, name := range names {
+				repl := undoSwitches(s.Files[name])
+				if c, err = c.apply(repl, pkgDir, filepath.Join(pkgDir, filepath.FromSlash(name))); err != nil {
+					err = fmt.Errorf("%s: %s", name, err)
+					break steps
+				}
+			}
+		case 2:
+			c.setCategories(nil)
+			err = c.format()
+		case 3:
+			err = r.verifyBeforeWrite(c)
+		case 4:
+			err = r.write(pkgDir, c)
+		case 5:
+			if !r.DryRun {
+				err = leaveDevelop(pkgDir)
+			}
+		case 6:
+			err = r.verifyAfterWrite(c)
+		}
+	}
+	return
+}
+
+// leaveDevelop removes the develop state file inside dir, if there is one
+func leaveDevelop(dir string) error {
+	err := os.Remove(developPath(dir))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// DevelopStatus returns the develop state of the package inside dir,
+// or nil if it is not in develop mode
+func DevelopStatus(dir string) (*DevelopState, error) {
+	s, err := ReadDevelopState(dir)
+	if err == ErrNotInDevelopMode {
+		return nil, nil
+	}
+	return s, err
+}
@@ -0,0 +1,121 @@
+package gpk
+
+import (
+	"testing"
+)
+
+func TestDevelopSwitches(t *testing.T) {
+	original := "package a // import \"gopkg.in/a/b.v1/a\"\n\n" +
+		"// see gopkg.in/a/b.v1.2.\nimport (\n\t\"gopkg.in/a/b.v1.2/c\"\n\t\"gopkg.in/a/b.v1\"\n)\n"
+
+	repl := replaceFile{gopkgin: "gopkg.in/a/b", target: "github.com/a/b"}
+	replaced, _, err := importCommentReplacer{repl}.replaceInFile([]byte(original))
+	if err != nil {
+		t.Fatal(err)
+	}
+	replaced, _, err = repl.replaceInFile(replaced)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := &FileChange{Original: []byte(original), Replaced: replaced}
+	sw := f.switches("gopkg.in/a/b", "github.com/a/b")
+
+	// the comment is not quoted and remains
+	expected := []PathSwitch{
+		{"gopkg.in/a/b.v1/a", "github.com/a/b/a", 0},
+		{"gopkg.in/a/b.v1.2/c", "github.com/a/b/c", 0},
+		{"gopkg.in/a/b.v1", "github.com/a/b", 0},
+	}
+
+	if len(sw) != len(expected) {
+		t.Fatalf("switches() = %#v; want %#v", sw, expected)
+	}
+
+	for i := range sw {
+		if got, want := sw[i], expected[i]; got != want {
+			t.Errorf("switches()[%d] = %#v; want %#v", i, got, want)
+		}
+	}
+
+	undone, sites, err := undoSwitches(sw).replaceInFile(replaced)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := string(undone), original; got != want || sites != 3 {
+		t.Errorf("undoSwitches = %#v, %d; want %#v, %d", got, sites, want, 3)
+	}
+
+	_, _, err = undoSwitches(sw).replaceInFile([]byte(original))
+	if err == nil {
+		t.Errorf("undoSwitches must fail if the rewritten paths are missing")
+	}
+}
+
+func TestDevelopSwitchesExisting(t *testing.T) {
+	original := "// Package a, see https://github.com/a/b for docs\npackage a\n\n" +
+		"import (\n\t\"gopkg.in/a/b.v1\"\n)\n\n// github.com/a/b again\n"
+
+	repl := replaceFile{gopkgin: "gopkg.in/a/b", target: "github.com/a/b"}
+	replaced, _, err := repl.replaceInFile([]byte(original))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := &FileChange{Original: []byte(original), Replaced: replaced}
+	sw := f.switches("gopkg.in/a/b", "github.com/a/b")
+
+	// the reference inside the doc comment comes first
+	if want := (PathSwitch{"gopkg.in/a/b.v1", "github.com/a/b", 1}); len(sw) != 1 || sw[0] != want {
+		t.Fatalf("switches() = %#v; want %#v", sw, []PathSwitch{want})
+	}
+
+	undone, _, err := undoSwitches(sw).replaceInFile(replaced)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := string(undone), original; got != want {
+		t.Errorf("undoSwitches = %#v; want %#v", got, want)
+	}
+}
+
+func TestAppendSwitches(t *testing.T) {
+	sw := []PathSwitch{{"gopkg.in/a/b.v1", "github.com/a/b", 1}, {"gopkg.in/a/b.v1/c", "github.com/a/b/c", 0}}
+	added := []PathSwitch{{"gopkg.in/a/b.v1", "github.com/a/b", 0}, {"gopkg.in/a/b.v1", "github.com/a/b", 3}}
+
+	sw = appendSwitches(sw, added)
+	if len(sw) != 4 || sw[0].Index != 2 || sw[1].Index != 0 {
+		t.Errorf("appendSwitches() = %#v; want the index of the first switch shifted to 2", sw)
+	}
+}
+
+func TestDevelopSwitchesAddedComment(t *testing.T) {
+	original := "package a\n\n// see github.com/a/b/a\nimport \"gopkg.in/a/b.v1/c\"\n"
+
+	replaced, _, err := addImportComment{"github.com/a/b/a"}.replaceInFile([]byte(original))
+	if err != nil {
+		t.Fatal(err)
+	}
+	repl := replaceFile{gopkgin: "gopkg.in/a/b", target: "github.com/a/b"}
+	replaced, _, err = repl.replaceInFile(replaced)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := &FileChange{Original: []byte(original), Replaced: replaced}
+	sw := f.switches("gopkg.in/a/b", "github.com/a/b")
+	if len(sw) != 2 || sw[1] != (PathSwitch{"", "github.com/a/b/a", 0}) {
+		t.Fatalf("switches() = %#v; want the switch of c and the added comment", sw)
+	}
+
+	undone, _, err := undoSwitches(sw).replaceInFile(replaced)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := string(undone), original; got != want {
+		t.Errorf("undoSwitches = %#v; want %#v", got, want)
+	}
+}
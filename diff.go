@@ -0,0 +1,180 @@
+package gpk
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines shown around a change
+const diffContext = 3
+
+type diffOp int
+
+const (
+	diffEqual diffOp = iota
+	diffDelete
+	diffInsert
+)
+
+type diffLine struct {
+	op   diffOp
+	text string
+	a, b int // line index in the original and the replaced file
+}
+
+// splitLines splits in into lines, keeping the line endings
+func splitLines(in []byte) []string {
+	if len(in) == 0 {
+		return nil
+	}
+	lines := strings.SplitAfter(string(in), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines returns the edit script that transforms a into b.
+// Common prefix and suffix are stripped before the lcs table is build,
+// since import rewrites only touch a few lines.
+func diffLines(a, b []string) []diffLine {
+	var pre, suf int
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		pre++
+	}
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+
+	ma, mb := a[pre:len(a)-suf], b[pre:len(b)-suf]
+
+	// lcs[i][j] is the length of the longest common subsequence of ma[i:] and mb[j:]
+	lcs := make([][]int, len(ma)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(mb)+1)
+	}
+	for i := len(ma) - 1; i >= 0; i-- {
+		for j := len(mb) - 1; j >= 0; j-- {
+			if ma[i] == mb[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var res []diffLine
+	for i := 0; i < pre; i++ {
+		res = append(res, diffLine{diffEqual, a[i], i, i})
+	}
+
+	i, j := 0, 0
+	for i < len(ma) || j < len(mb) {
+		switch {
+		case i < len(ma) && j < len(mb) && ma[i] == mb[j]:
+			res = append(res, diffLine{diffEqual, ma[i], pre + i, pre + j})
+			i++
+			j++
+		case j == len(mb) || (i < len(ma) && lcs[i+1][j] >= lcs[i][j+1]):
+			res = append(res, diffLine{diffDelete, ma[i], pre + i, pre + j})
+			i++
+		default:
+			res = append(res, diffLine{diffInsert, mb[j], pre + i, pre + j})
+			j++
+		}
+	}
+
+	for k := 0; k < suf; k++ {
+		res = append(res, diffLine{diffEqual, a[len(a)-suf+k], len(a) - suf + k, len(b) - suf + k})
+	}
+	return res
+}
+
+// hunkRange formats the range of a hunk header
+func hunkRange(start, count int) string {
+	if count == 0 {
+		// an empty range refers to the line before
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+// UnifiedDiff returns the unified diff between original and replaced
+// for the file with the given name. It returns an empty string, if there
+// are no differences.
+func UnifiedDiff(name string, original, replaced []byte) string {
+	if bytes.Equal(original, replaced) {
+		return ""
+	}
+
+	lines := diffLines(splitLines(original), splitLines(replaced))
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "--- a/%s\n+++ b/%s\n", name, name)
+
+	for start := 0; start < len(lines); {
+		// find the next change
+		for start < len(lines) && lines[start].op == diffEqual {
+			start++
+		}
+		if start == len(lines) {
+			break
+		}
+
+		// extend the hunk until there are more than 2*diffContext unchanged lines
+		end, equal := start, 0
+		for k := start; k < len(lines) && equal <= 2*diffContext; k++ {
+			if lines[k].op == diffEqual {
+				equal++
+				continue
+			}
+			equal = 0
+			end = k + 1
+		}
+
+		from := start - diffContext
+		if from < 0 {
+			from = 0
+		}
+		to := end + diffContext
+		if to > len(lines) {
+			to = len(lines)
+		}
+
+		var countA, countB int
+		for _, l := range lines[from:to] {
+			if l.op != diffInsert {
+				countA++
+			}
+			if l.op != diffDelete {
+				countB++
+			}
+		}
+
+		fmt.Fprintf(&buf, "@@ -%s +%s @@\n", hunkRange(lines[from].a, countA), hunkRange(lines[from].b, countB))
+
+		for _, l := range lines[from:to] {
+			switch l.op {
+			case diffEqual:
+				buf.WriteString(" ")
+			case diffDelete:
+				buf.WriteString("-")
+			case diffInsert:
+				buf.WriteString("+")
+			}
+			buf.WriteString(l.text)
+			if !strings.HasSuffix(l.text, "\n") {
+				buf.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		start = to
+	}
+
+	return buf.String()
+}
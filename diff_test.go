@@ -0,0 +1,42 @@
+package gpk
+
+import (
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+
+	tests := []struct {
+		original string
+		replaced string
+		expected string
+	}{
+		{"a\nb\n", "a\nb\n", ""},
+		{
+			"a\nb\nc\n",
+			"a\nx\nc\n",
+			"--- a/f.go\n+++ b/f.go\n@@ -1,3 +1,3 @@\n a\n-b\n+x\n c\n",
+		},
+		{
+			"1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n",
+			"1\n2\n3\n4\n5\n6\n7\n8\n9\nX\n",
+			"--- a/f.go\n+++ b/f.go\n@@ -7,4 +7,4 @@\n 7\n 8\n 9\n-10\n+X\n",
+		},
+		{
+			"1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n",
+			"X\n2\n3\n4\n5\n6\n7\n8\n9\n10\nY\n",
+			"--- a/f.go\n+++ b/f.go\n@@ -1,4 +1,4 @@\n-1\n+X\n 2\n 3\n 4\n@@ -8,4 +8,4 @@\n 8\n 9\n 10\n-11\n+Y\n",
+		},
+		{
+			"a\n",
+			"a\nb",
+			"--- a/f.go\n+++ b/f.go\n@@ -1 +1,2 @@\n a\n+b\n\\ No newline at end of file\n",
+		},
+	}
+
+	for _, test := range tests {
+		if got, want := UnifiedDiff("f.go", []byte(test.original), []byte(test.replaced)), test.expected; got != want {
+			t.Errorf("UnifiedDiff(%#v, %#v) = %#v; want %#v", test.original, test.replaced, got, want)
+		}
+	}
+}
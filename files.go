@@ -0,0 +1,106 @@
+package gpk
+
+import (
+	"bytes"
+	"fmt"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+)
+
+// FileCategory tells, where a rewritten file comes from
+type FileCategory string
+
+const (
+	// GoFile is a file of build.Package.GoFiles
+	GoFile FileCategory = "go"
+
+	// CgoFile is a file of build.Package.CgoFiles
+	CgoFile FileCategory = "cgo"
+
+	// TestGoFile is a file of build.Package.TestGoFiles
+	TestGoFile FileCategory = "test"
+
+	// XTestGoFile is a file of build.Package.XTestGoFiles (external _test package)
+	XTestGoFile FileCategory = "xtest"
+
+	// IgnoredGoFile is a go file that is excluded by build constraints
+	IgnoredGoFile FileCategory = "ignored"
+
+	// OtherGoFile is any other go file inside the package directory
+	OtherGoFile FileCategory = "other"
+
+	// TextFile is a non go file matching the Globs of a Rewriter
+	TextFile FileCategory = "text"
+)
+
+// ParseErrors is returned by a rewrite, if go files of the rewritten packages
+// do not parse. Nothing is written in this case.
+type ParseErrors map[string]error
+
+func (p ParseErrors) Error() string {
+	var files []string
+	for f := range p {
+		files = append(files, f)
+	}
+	sort.Strings(files)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%d go files do not parse:", len(files))
+	for _, f := range files {
+		fmt.Fprintf(&buf, "\n\t%s", p[f])
+	}
+	return buf.String()
+}
+
+// fileCategories returns the category of every go file inside the directory of pkg
+func fileCategories(pkg *build.Package) (map[string]FileCategory, error) {
+	all, err := filepath.Glob(filepath.Join(pkg.Dir, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+
+	cats := map[string]FileCategory{}
+	for _, f := range all {
+		cats[filepath.Base(f)] = OtherGoFile
+	}
+
+	for cat, files := range map[FileCategory][]string{
+		GoFile:        pkg.GoFiles,
+		CgoFile:       pkg.CgoFiles,
+		TestGoFile:    pkg.TestGoFiles,
+		XTestGoFile:   pkg.XTestGoFiles,
+		IgnoredGoFile: pkg.IgnoredGoFiles,
+	} {
+		for _, f := range files {
+			if _, has := cats[f]; has {
+				cats[f] = cat
+			}
+		}
+	}
+	return cats, nil
+}
+
+// checkParse parses the given go files and returns the failing ones
+func checkParse(files []string) ParseErrors {
+	errs := ParseErrors{}
+	fset := token.NewFileSet()
+
+	for _, f := range files {
+		src, err := ioutil.ReadFile(f)
+		if err == nil {
+			_, err = parser.ParseFile(fset, f, src, 0)
+		}
+		if err != nil {
+			errs[f] = err
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
@@ -0,0 +1,73 @@
+package gpk
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileCategories(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gpk-files")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"a.go":       "package a\n",
+		"a_test.go":  "package a\n",
+		"x_test.go":  "package a_test\n",
+		"ignore.go":  "// +build ignore\n\npackage main\n",
+		"broken.go":  "// +build ignore\n\npackage main\nfunc (\n",
+		"a_plan9.go": "package a\n",
+		"README.md":  "a",
+		"sub/sub.go": "package sub\n",
+	}
+	os.Mkdir(filepath.Join(dir, "sub"), 0755)
+
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pkg, err := Pkg(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cats, err := fileCategories(pkg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]FileCategory{
+		"a.go":       GoFile,
+		"a_test.go":  TestGoFile,
+		"x_test.go":  XTestGoFile,
+		"ignore.go":  IgnoredGoFile,
+		"broken.go":  IgnoredGoFile,
+		"a_plan9.go": IgnoredGoFile,
+	}
+
+	if len(cats) != len(expected) {
+		t.Errorf("len(cats) = %d // expected: %d", len(cats), len(expected))
+	}
+
+	for file, cat := range expected {
+		if got, want := cats[file], cat; got != want {
+			t.Errorf("category of %s = %#v; want %#v", file, got, want)
+		}
+	}
+
+	var paths []string
+	for file := range cats {
+		paths = append(paths, filepath.Join(dir, file))
+	}
+
+	errs := checkParse(paths)
+	if len(errs) != 1 || errs[filepath.Join(dir, "broken.go")] == nil {
+		t.Errorf("checkParse() = %v; want error for broken.go", errs)
+	}
+}
@@ -0,0 +1,253 @@
+package gpk
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/build"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ForksFile is the name of the file inside the package dir that tracks
+// the dependencies that are redirected to forks
+const ForksFile = ".gpk-forks"
+
+var ErrNotForked = errors.New("upstream is not redirected to a fork")
+
+// ForkState records, which paths have been redirected from the upstream to the fork
+type ForkState struct {
+	Fork string
+
+	// Files maps the paths of the rewritten files relative to the package dir
+	// to their rewritten paths
+	Files map[string][]PathSwitch
+}
+
+// forkReplacer replaces quoted import paths of the upstream, its subpackages
+// and its gopkg.in variants by the fork
+type forkReplacer struct {
+	upstream string
+	gopkgin  string
+	fork     string
+}
+
+func newForkReplacer(upstream, fork string) forkReplacer {
+	f := forkReplacer{upstream: upstream, fork: fork}
+	if gopkgin, err := bareGoPkginPath(upstream); err == nil {
+		f.gopkgin = gopkgin
+	}
+	return f
+}
+
+// mapPath returns the path inside the fork for the import path p
+func (f forkReplacer) mapPath(p string) (string, bool) {
+	if p == f.upstream || strings.HasPrefix(p, f.upstream+"/") {
+		return f.fork + p[len(f.upstream):], true
+	}
+
+	if f.gopkgin == "" || !strings.HasPrefix(p, f.gopkgin+".v") {
+		return "", false
+	}
+
+	rest := p[len(f.gopkgin)+2:]
+	l := matchVersion([]byte(rest))
+	if l == 0 || l < len(rest) && rest[l] != '/' {
+		return "", false
+	}
+	return f.fork + rest[l:], true
+}
+
+// matches reports whether one of the given imports is redirected
+func (f forkReplacer) matches(imports []string, _ string) bool {
+	for _, im := range imports {
+		if _, ok := f.mapPath(im); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (f forkReplacer) replaceInFile(in []byte) ([]byte, int, error) {
+	var sites int
+	out := quotedRegexp.ReplaceAllFunc(in, func(quoted []byte) []byte {
+		p, ok := f.mapPath(string(quoted[1 : len(quoted)-1]))
+		if !ok {
+			return quoted
+		}
+		sites++
+		return []byte(strconv.Quote(p))
+	})
+	return out, sites, nil
+}
+
+// switches returns the path switches of a change made by the replacer
+func (f forkReplacer) switches(c *FileChange) []PathSwitch {
+	var (
+		sw     []PathSwitch
+		starts []int
+	)
+	for _, loc := range quotedRegexp.FindAllIndex(c.Original, -1) {
+		original := string(c.Original[loc[0]+1 : loc[1]-1])
+		if p, ok := f.mapPath(original); ok {
+			sw = append(sw, PathSwitch{Original: original, Replaced: p})
+			starts = append(starts, loc[0]+1)
+		}
+	}
+	indexSwitches(c.Original, sw, starts)
+	return sw
+}
+
+func forksPath(dir string) string {
+	return filepath.Join(dir, ForksFile)
+}
+
+// Forks returns the forks of the package inside dir, mapped by their upstreams
+func Forks(dir string) (map[string]*ForkState, error) {
+	forks := map[string]*ForkState{}
+	data, err := ioutil.ReadFile(forksPath(dir))
+	if os.IsNotExist(err) {
+		return forks, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, &forks)
+	return forks, err
+}
+
+// saveForks writes the forks to the forks file inside dir, or removes it if there are none
+func saveForks(dir string, forks map[string]*ForkState) error {
+	if len(forks) == 0 {
+		err := os.Remove(forksPath(dir))
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	data, err := json.MarshalIndent(forks, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(forksPath(dir), data, 0644)
+}
+
+// Fork redirects every import of upstream, its subpackages and its gopkg.in variants
+// in every package beneath pkgDir to the fork. The redirect is recorded in the ForksFile,
+// so that Unfork can restore the original paths.
+func Fork(pkgDir, upstream, fork string) error {
+	_, err := (&Rewriter{}).Fork(pkgDir, upstream, fork)
+	return err
+}
+
+// Fork is like the function Fork but returns the changes
+func (r *Rewriter) Fork(pkgDir, upstream, fork string) (c Changes, err error) {
+	var (
+		pkg    *build.Package
+		forks  map[string]*ForkState
+		repl   = newForkReplacer(upstream, fork)
+		walker = &dependentsWalker{inSliceFn: repl.matches}
+	)
+
+steps:
+	for jump := 1; err == nil; jump++ {
+		switch jump - 1 {
+		default:
+			break steps
+		case 0:
+			forks, err = Forks(pkgDir)
+		case 1:
+			if f, has := forks[upstream]; has && f.Fork != fork {
+				err = fmt.Errorf("%s is already redirected to %s", upstream, f.Fork)
+			}
+		case 2:
+			pkg, err = Pkg(pkgDir)
+		case 3:
+			err = filepath.Walk(pkgDir, walker.Walk)
+		case 4:
+			c, err = r.rewrite(repl, nil, pkgDir, pkg.SrcRoot, walker.deps)
+		case 5:
+			if r.DryRun || len(c) == 0 {
+				break steps
+			}
+			f, has := forks[upstream]
+			if !has {
+				f = &ForkState{Fork: fork, Files: map[string][]PathSwitch{}}
+				forks[upstream] = f
+			}
+			for _, ch := range c {
+				name := filepath.ToSlash(ch.Name)
+				f.Files[name] = appendSwitches(f.Files[name], repl.switches(ch))
+			}
+			err = saveForks(pkgDir, forks)
+		case 6:
+			err = r.verifyAfterWrite(c)
+		}
+	}
+	return
+}
+
+// Unfork restores the original paths that have been redirected from upstream to a fork by Fork
+func Unfork(pkgDir, upstream string) error {
+	_, err := (&Rewriter{}).Unfork(pkgDir, upstream)
+	return err
+}
+
+// Unfork is like the function Unfork but returns the changes.
+// It fails without writing anything, if a file does not contain the
+// redirected paths anymore.
+func (r *Rewriter) Unfork(pkgDir, upstream string) (c Changes, err error) {
+	var (
+		forks map[string]*ForkState
+		f     *ForkState
+		names []string
+	)
+
+steps:
+	for jump := 1; err == nil; jump++ {
+		switch jump - 1 {
+		default:
+			break steps
+		case 0:
+			forks, err = Forks(pkgDir)
+		case 1:
+			var has bool
+			if f, has = forks[upstream]; !has {
+				err = ErrNotForked
+			}
+		case 2:
+			for name := range f.Files {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+
+			for _, name := range names {
+				if c, err = c.apply(undoSwitches(f.Files[name]), pkgDir, filepath.Join(pkgDir, filepath.FromSlash(name))); err != nil {
+					err = fmt.Errorf("%s: %s", name, err)
+					break steps
+				}
+			}
+		case 3:
+			c.setCategories(nil)
+			err = c.format()
+		case 4:
+			err = r.verifyBeforeWrite(c)
+		case 5:
+			err = r.write(pkgDir, c)
+		case 6:
+			if !r.DryRun {
+				delete(forks, upstream)
+				err = saveForks(pkgDir, forks)
+			}
+		case 7:
+			err = r.verifyAfterWrite(c)
+		}
+	}
+	return
+}
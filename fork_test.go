@@ -0,0 +1,48 @@
+package gpk
+
+import (
+	"testing"
+)
+
+func TestForkReplacer(t *testing.T) {
+	repl := newForkReplacer("github.com/a/b", "github.com/me/b")
+
+	in := "import (\n\t\"github.com/a/b\"\n\t\"github.com/a/b/c\"\n\t\"gopkg.in/a/b.v2.1/d\"\n\t\"gopkg.in/a/b.v1\"\n\t\"github.com/a/bc\"\n\t\"gopkg.in/a/b.vx\"\n)\n"
+	expected := "import (\n\t\"github.com/me/b\"\n\t\"github.com/me/b/c\"\n\t\"github.com/me/b/d\"\n\t\"github.com/me/b\"\n\t\"github.com/a/bc\"\n\t\"gopkg.in/a/b.vx\"\n)\n"
+
+	out, sites, _ := repl.replaceInFile([]byte(in))
+	if got, want := string(out), expected; got != want || sites != 4 {
+		t.Fatalf("replaceInFile(%#v) = %#v, %d; want %#v, %d", in, got, sites, want, 4)
+	}
+
+	sw := repl.switches(&FileChange{Original: []byte(in), Replaced: out})
+	if len(sw) != 4 {
+		t.Fatalf("switches() = %#v; want 4 switches", sw)
+	}
+
+	undone, _, err := undoSwitches(sw).replaceInFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := string(undone), in; got != want {
+		t.Errorf("undoSwitches = %#v; want %#v", got, want)
+	}
+}
+
+func TestForkSwitchesExisting(t *testing.T) {
+	repl := newForkReplacer("github.com/a/b", "github.com/me/b")
+
+	in := "// fork of github.com/me/b\nimport (\n\t\"github.com/a/b\"\n)\n"
+	out, _, _ := repl.replaceInFile([]byte(in))
+
+	sw := repl.switches(&FileChange{Original: []byte(in), Replaced: out})
+	undone, _, err := undoSwitches(sw).replaceInFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := string(undone), in; got != want {
+		t.Errorf("undoSwitches = %#v; want %#v", got, want)
+	}
+}
@@ -0,0 +1,264 @@
+package gpk
+
+import (
+	"fmt"
+	"go/build"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Gate is a check of the repo inside a dir that must pass before a version is tagged
+type Gate struct {
+	Name  string
+	Check func(dir string) error
+}
+
+// GateResult is the result of a gate, Err is nil if it passed
+type GateResult struct {
+	Name string
+	Err  error
+}
+
+func (g GateResult) String() string {
+	if g.Err != nil {
+		return fmt.Sprintf("%s: FAILED: %s", g.Name, g.Err)
+	}
+	return fmt.Sprintf("%s: ok", g.Name)
+}
+
+var (
+	// GateClean passes, if the working tree has no changes
+	GateClean = Gate{"clean", checkClean}
+
+	// GateUpstream passes, if the branch is not behind its upstream or,
+	// for a detached HEAD, if the commit is part of a remote branch
+	GateUpstream = Gate{"upstream", checkUpstream}
+
+	// GateVet passes, if go vet ./... passes
+	GateVet = Gate{"vet", goCheck("vet", "./...")}
+
+	// GateTest passes, if go test ./... passes
+	GateTest = Gate{"test", goCheck("test", "./...")}
+
+	// GateDevelop passes, if the package is not in develop mode
+	GateDevelop = Gate{"develop", checkDevelop}
+)
+
+// DefaultGates are the gates in the order they run by default
+var DefaultGates = []Gate{GateClean, GateUpstream, GateDevelop, GateVet, GateTest}
+
+// GatesByName returns the default gates of the given names in the given order
+func GatesByName(names ...string) ([]Gate, error) {
+	var gates []Gate
+	for _, name := range names {
+		var found bool
+		for _, g := range DefaultGates {
+			if g.Name == name {
+				gates = append(gates, g)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown gate: %s", name)
+		}
+	}
+	return gates, nil
+}
+
+func checkClean(dir string) error {
+	changed, err := gitLines(dir, "status", "--porcelain")
+	if err != nil {
+		return err
+	}
+	if len(changed) > 0 {
+		return fmt.Errorf("%d uncommitted changes, e.g. %s", len(changed), strings.TrimSpace(changed[0]))
+	}
+	return nil
+}
+
+func checkUpstream(dir string) error {
+	if _, err := gitCmd(dir, "fetch", "--quiet"); err != nil {
+		return err
+	}
+
+	// a detached HEAD, e.g. the worktree of a pushed commit, has no upstream
+	if _, err := gitCmd(dir, "symbolic-ref", "--quiet", "HEAD"); err != nil {
+		branches, err := gitLines(dir, "branch", "--remotes", "--contains", "HEAD")
+		if err != nil {
+			return err
+		}
+		if len(branches) == 0 {
+			return fmt.Errorf("the commit is not part of a remote branch")
+		}
+		return nil
+	}
+
+	// prints the commits of HEAD and the upstream, that the other does not have
+	counts, err := gitCmd(dir, "rev-list", "--left-right", "--count", "HEAD...@{upstream}")
+	if err != nil {
+		return err
+	}
+
+	fields := strings.Fields(counts)
+	if len(fields) != 2 {
+		return fmt.Errorf("unexpected output of git rev-list: %s", counts)
+	}
+
+	behind, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return err
+	}
+	if behind > 0 {
+		return fmt.Errorf("the branch is %d commits behind its upstream", behind)
+	}
+	return nil
+}
+
+// checkDevelop fails, if the package is in develop mode or if a package beneath dir
+// still imports the github path of the package, e.g. because it has been switched by hand
+func checkDevelop(dir string) error {
+	s, err := DevelopStatus(dir)
+	if err != nil {
+		return err
+	}
+	if s != nil {
+		return fmt.Errorf("%d files are in develop mode, run gpk undevelop", len(s.Files))
+	}
+
+	// Walk skips "." as a hidden dir
+	if dir, err = filepath.Abs(dir); err != nil {
+		return err
+	}
+
+	pkg, err := Pkg(dir)
+	if err != nil {
+		return err
+	}
+
+	pkgPath, err := PkgPath(pkg)
+	if err != nil {
+		return err
+	}
+	pkgPath = filepath.ToSlash(pkgPath)
+
+	// only github packages are released to gopkg.in
+	if _, err = bareGoPkginPath(pkgPath); err != nil {
+		return nil
+	}
+
+	// subpackages with their own tag prefix are imported by their github paths
+	exclude, err := versionedPackages(dir)
+	if err != nil {
+		return err
+	}
+
+	walker := &dependentsWalker{relpath: pkgPath, inSliceFn: func(imports []string, p string) bool {
+		for _, im := range imports {
+			if (im == p || strings.HasPrefix(im, p+"/")) && !excluded(exclude, []byte(im)) {
+				return true
+			}
+		}
+		return false
+	}}
+	if err = filepath.Walk(dir, walker.Walk); err != nil {
+		return err
+	}
+
+	if len(walker.deps) > 0 {
+		return fmt.Errorf("%d packages import the github path %s, e.g. %s", len(walker.deps), pkgPath, walker.deps[0])
+	}
+	return nil
+}
+
+// goCheck returns a check that runs the go tool with the given args
+func goCheck(args ...string) func(dir string) error {
+	return func(dir string) error {
+		cmd := exec.Command("go", args...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("go %s: %s\n%s", args[0], err, strings.TrimSpace(string(out)))
+		}
+		return nil
+	}
+}
+
+// runGates runs the gates of the Pusher inside dir and reports every result.
+// It stops at the first failing gate.
+func (p *Pusher) runGates(dir string) error {
+	for _, g := range p.Gates {
+		res := GateResult{Name: g.Name, Err: g.Check(dir)}
+		if p.Report != nil {
+			p.Report(res)
+		}
+		if res.Err != nil {
+			return fmt.Errorf("gate %s failed: %s", g.Name, res.Err)
+		}
+	}
+	return nil
+}
+
+// setGOPATH sets the GOPATH of the go tool and of go/build and returns a func that restores them
+func setGOPATH(gopath string) func() {
+	env, def := os.Getenv("GOPATH"), build.Default.GOPATH
+	os.Setenv("GOPATH", gopath)
+	build.Default.GOPATH = gopath
+	return func() {
+		os.Setenv("GOPATH", env)
+		build.Default.GOPATH = def
+	}
+}
+
+// runGatesAt runs the gates of the Pusher for the commit rev of the repo inside dir.
+// If rev is neither empty nor checked out, the gates run inside a temporary worktree
+// at rev, so that the code that is tagged is the code that is checked.
+// A Ref that is a local branch is checked out in the worktree, so that its upstream is known.
+// If the package is inside a GOPATH, the worktree is placed at the import path of the repo
+// below a temporary GOPATH that precedes the others, so that the gates resolve the
+// imports of the repo to the worktree.
+func (p *Pusher) runGatesAt(dir, rev string) error {
+	if rev == "" || rev == revision(dir, "HEAD") {
+		return p.runGates(dir)
+	}
+
+	// the path of the package inside the repo
+	prefix, err := gitCmd(dir, "rev-parse", "--show-prefix")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempDir("", "gpk-gates")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	worktree := tmp
+	if pkg, err := Pkg(dir); err == nil && pkg.SrcRoot != "" {
+		pkgPath, err := PkgPath(pkg)
+		if err != nil {
+			return err
+		}
+		// the import path of the repo is the one of the package without its path inside the repo
+		repoPath := strings.TrimSuffix(filepath.ToSlash(pkgPath), strings.TrimSuffix("/"+prefix, "/"))
+		worktree = filepath.Join(tmp, "src", filepath.FromSlash(repoPath))
+		if err = os.MkdirAll(filepath.Dir(worktree), 0755); err != nil {
+			return err
+		}
+		defer setGOPATH(tmp + string(filepath.ListSeparator) + build.Default.GOPATH)()
+	}
+
+	args := []string{"worktree", "add", "--detach", worktree, rev}
+	if p.Ref != "" && revision(dir, "refs/heads/"+p.Ref) == rev {
+		args = []string{"worktree", "add", worktree, p.Ref}
+	}
+	if _, err = gitCmd(dir, args...); err != nil {
+		return err
+	}
+	defer gitCmd(dir, "worktree", "remove", "--force", worktree)
+
+	return p.runGates(filepath.Join(worktree, filepath.FromSlash(prefix)))
+}
@@ -0,0 +1,175 @@
+package gpk
+
+import (
+	"errors"
+	"go/build"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGatesByName(t *testing.T) {
+	gates, err := GatesByName("test", "clean")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(gates) != 2 || gates[0].Name != "test" || gates[1].Name != "clean" {
+		t.Errorf("GatesByName() = %#v; want test and clean", gates)
+	}
+
+	if _, err := GatesByName("unknown"); err == nil {
+		t.Errorf("GatesByName(\"unknown\") = nil error; want error")
+	}
+}
+
+func TestRunGates(t *testing.T) {
+	var (
+		reported []string
+		ran      []string
+	)
+
+	gate := func(name string, err error) Gate {
+		return Gate{name, func(string) error {
+			ran = append(ran, name)
+			return err
+		}}
+	}
+
+	p := &Pusher{
+		Gates:  []Gate{gate("a", nil), gate("b", errors.New("fails")), gate("c", nil)},
+		Report: func(res GateResult) { reported = append(reported, res.String()) },
+	}
+
+	if err := p.runGates("."); err == nil || err.Error() != "gate b failed: fails" {
+		t.Errorf("runGates() = %v; want gate b failed: fails", err)
+	}
+
+	if len(ran) != 2 {
+		t.Errorf("ran gates %v; want a and b", ran)
+	}
+
+	if len(reported) != 2 || reported[0] != "a: ok" || reported[1] != "b: FAILED: fails" {
+		t.Errorf("reported %#v; want a: ok and b: FAILED: fails", reported)
+	}
+}
+
+func TestRunGatesAt(t *testing.T) {
+	dir := tempRepo(t, map[string]string{"sub/a.go": "package a // old\n"})
+	defer os.RemoveAll(dir)
+
+	gitRun(t, dir, "branch", "maint")
+	old := revision(dir, "maint")
+	commitFile(t, dir, "sub/a.go", "package a // new\n", "feat: new")
+
+	var checked string
+	p := &Pusher{Ref: "maint", Gates: []Gate{{"content", func(dir string) error {
+		data, err := ioutil.ReadFile(filepath.Join(dir, "a.go"))
+		checked = string(data)
+		return err
+	}}, GateUpstream}}
+
+	// the branch has no upstream
+	err := p.runGatesAt(filepath.Join(dir, "sub"), old)
+	if err == nil || !strings.Contains(err.Error(), "gate upstream failed") {
+		t.Errorf("runGatesAt() = %v; want the upstream gate failed", err)
+	}
+
+	if checked != "package a // old\n" {
+		t.Errorf("gates checked %#v; want the files of the ref", checked)
+	}
+
+	if worktrees := gitRun(t, dir, "worktree", "list"); strings.Count(worktrees, "\n") != 0 {
+		t.Errorf("worktree list = %#v; want the temporary worktree removed", worktrees)
+	}
+}
+
+func TestRunDefaultGatesAt(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go is not installed")
+	}
+
+	gopath, err := ioutil.TempDir("", "gpk-gopath")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(gopath)
+
+	defer func(p, env, mod, flags string) {
+		build.Default.GOPATH = p
+		os.Setenv("GOPATH", env)
+		os.Setenv("GO111MODULE", mod)
+		os.Setenv("GOFLAGS", flags)
+	}(build.Default.GOPATH, os.Getenv("GOPATH"), os.Getenv("GO111MODULE"), os.Getenv("GOFLAGS"))
+	build.Default.GOPATH = gopath
+	os.Setenv("GOPATH", gopath)
+	os.Setenv("GO111MODULE", "off")
+	os.Setenv("GOFLAGS", "")
+
+	// sub is versioned on its own and imported by its github path
+	origin := tempRepo(t, map[string]string{
+		"b.go":                "package b\n\nimport \"github.com/a/b/sub\"\n\nvar B = sub.F()\n",
+		"sub/sub.go":          "package sub\n\nfunc F() int { return 1 }\n",
+		"sub/.gpk-tag-prefix": "sub/\n",
+	})
+	defer os.RemoveAll(origin)
+
+	dir := filepath.Join(gopath, "src", "github.com", "a", "b")
+	gitRun(t, gopath, "clone", "-q", origin, dir)
+	gitRun(t, dir, "config", "user.name", "gpk")
+	gitRun(t, dir, "config", "user.email", "gpk@example.com")
+	gitRun(t, dir, "config", "commit.gpgsign", "false")
+	ref := revision(dir, "HEAD")
+
+	// the checked out code does not compile, the pushed ref does
+	commitFile(t, dir, "sub/sub.go", "package sub\n", "feat!: remove F")
+
+	p := &Pusher{Ref: ref, Gates: DefaultGates}
+	if err := p.runGatesAt(dir, ref); err != nil {
+		t.Errorf("runGatesAt(ref) = %v; want nil", err)
+	}
+
+	if build.Default.GOPATH != gopath || os.Getenv("GOPATH") != gopath {
+		t.Errorf("GOPATH = %#v; want %#v restored", build.Default.GOPATH, gopath)
+	}
+
+	if err := p.runGatesAt(dir, ""); err == nil || !strings.Contains(err.Error(), "gate vet failed") {
+		t.Errorf("runGatesAt(HEAD) = %v; want the vet gate failed", err)
+	}
+}
+
+func TestCheckDevelopImports(t *testing.T) {
+	gopath, err := ioutil.TempDir("", "gpk-gopath")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(gopath)
+
+	defer func(p, mod string) {
+		build.Default.GOPATH = p
+		os.Setenv("GO111MODULE", mod)
+	}(build.Default.GOPATH, os.Getenv("GO111MODULE"))
+	build.Default.GOPATH = gopath
+	os.Setenv("GO111MODULE", "off")
+
+	dir := filepath.Join(gopath, "src", "github.com", "a", "b")
+	writeFiles(t, dir, map[string]string{
+		"b.go":                "package b\n\nimport _ \"gopkg.in/a/b.v1/c\"\n",
+		"c/c.go":              "package c\n",
+		"d/d.go":              "package d\n\nimport _ \"github.com/a/b/sub\"\n",
+		"sub/sub.go":          "package sub\n",
+		"sub/.gpk-tag-prefix": "sub/\n",
+	})
+
+	// sub is versioned on its own
+	if err := checkDevelop(dir); err != nil {
+		t.Errorf("checkDevelop() = %v; want nil", err)
+	}
+
+	writeFiles(t, dir, map[string]string{"b.go": "package b\n\nimport _ \"github.com/a/b/c\"\n"})
+	if err := checkDevelop(dir); err == nil || !strings.Contains(err.Error(), "github.com/a/b,") {
+		t.Errorf("checkDevelop() = %v; want the import of the github path reported", err)
+	}
+}
@@ -0,0 +1,102 @@
+package gpk
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+// gitCmd runs git with the given args inside dir and returns the trimmed output.
+// The error contains the message git has written to stderr.
+func gitCmd(dir string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if DEBUG {
+		fmt.Printf("git %s\n", strings.Join(args, " "))
+	}
+
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return "", fmt.Errorf("git %s: %s", args[0], msg)
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// gitLines is like gitCmd but returns the non empty lines of the output
+func gitLines(dir string, args ...string) ([]string, error) {
+	out, err := gitCmd(dir, args...)
+	if err != nil || out == "" {
+		return nil, err
+	}
+	return strings.Split(out, "\n"), nil
+}
+
+// gitCommitFiles stages the given files and commits exactly them with msg,
+// ignoring anything else that is staged
+func gitCommitFiles(dir, msg string, files []string) error {
+	if _, err := gitCmd(dir, append([]string{"add", "--"}, files...)...); err != nil {
+		return err
+	}
+	_, err := gitCmd(dir, append([]string{"commit", "-m", msg, "--only", "--"}, files...)...)
+	return err
+}
+
+// pushRemote returns the remote of the current branch inside dir, or origin if it has none
+func pushRemote(dir string) string {
+	branch, err := gitCmd(dir, "symbolic-ref", "--short", "HEAD")
+	if err != nil {
+		return "origin"
+	}
+	if remote, err := gitCmd(dir, "config", "branch."+branch+".remote"); err == nil && remote != "" {
+		return remote
+	}
+	return "origin"
+}
+
+// versionTag is a tag of a version
+type versionTag struct {
+	tag     string
+	version [3]int
+}
+
+type versionTags []versionTag
+
+func (v versionTags) Len() int           { return len(v) }
+func (v versionTags) Swap(i, j int)      { v[i], v[j] = v[j], v[i] }
+func (v versionTags) Less(i, j int) bool { return sortVersion{v[i].version, v[j].version}.Less(0, 1) }
+
+// sortedVersionTags returns the version tags inside tags that have the given prefix,
+// sorted by version
+func sortedVersionTags(tags []string, prefix string) versionTags {
+	var vt versionTags
+	for _, t := range tags {
+		if !strings.HasPrefix(t, prefix) {
+			continue
+		}
+		if v, err := parseVersion(t[len(prefix):]); err == nil {
+			vt = append(vt, versionTag{tag: t, version: v})
+		}
+	}
+	sort.Stable(vt)
+	return vt
+}
+
+// lastVersionTag returns the tag of the last version inside tags that has the given
+// prefix and the version. tag is empty, if there is no such version tag.
+func lastVersionTag(tags []string, prefix string) (tag string, version [3]int) {
+	vt := sortedVersionTags(tags, prefix)
+	if len(vt) == 0 {
+		return
+	}
+	last := vt[len(vt)-1]
+	return last.tag, last.version
+}
@@ -0,0 +1,85 @@
+package gpk
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// tempRepo creates a git repo inside a temporary dir with a commit of the given files.
+// The test is skipped, if git is not installed.
+func tempRepo(t *testing.T, files map[string]string) string {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir, err := ioutil.TempDir("", "gpk-repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gitRun(t, dir, "init", "-q")
+	gitRun(t, dir, "config", "user.name", "gpk")
+	gitRun(t, dir, "config", "user.email", "gpk@example.com")
+	gitRun(t, dir, "config", "commit.gpgsign", "false")
+	gitRun(t, dir, "config", "tag.gpgsign", "false")
+
+	writeFiles(t, dir, files)
+	gitRun(t, dir, "add", "-A")
+	gitRun(t, dir, "commit", "-q", "-m", "init")
+	return dir
+}
+
+// writeFiles writes the files with the given contents, mapped by their paths below dir
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// gitRun runs git inside dir and fails the test if git fails
+func gitRun(t *testing.T, dir string, args ...string) string {
+	out, err := gitCmd(dir, args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+// commitFile changes the file below dir and commits it with msg
+func commitFile(t *testing.T, dir, name, content, msg string) string {
+	writeFiles(t, dir, map[string]string{name: content})
+	gitRun(t, dir, "add", name)
+	gitRun(t, dir, "commit", "-q", "-m", msg)
+	return gitRun(t, dir, "rev-parse", "HEAD")
+}
+
+func TestCommitRelease(t *testing.T) {
+	dir := tempRepo(t, map[string]string{"a.go": "package a\n", "b.go": "package a\n"})
+	defer os.RemoveAll(dir)
+
+	// b.go is changed and staged, but not part of the release
+	writeFiles(t, dir, map[string]string{"a.go": "package a // a\n", "b.go": "package a // b\n"})
+	gitRun(t, dir, "add", "b.go")
+
+	c := Changes{&FileChange{Path: filepath.Join(dir, "a.go")}}
+	if err := (&Rewriter{}).commitRelease(dir, "v1.0", c); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := gitRun(t, dir, "show", "--format=%s", "--name-only", "HEAD"); got != "release v1.0\n\na.go" {
+		t.Errorf("committed %#v; want only a.go", got)
+	}
+
+	if got := gitRun(t, dir, "status", "--porcelain"); got != "M  b.go" {
+		t.Errorf("status = %#v; want b.go still staged", got)
+	}
+}
@@ -1,11 +1,13 @@
 package gpk
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"go/build"
+	"go/parser"
+	"go/token"
 	"gopkg.in/metakeule/gitlib.v1"
-	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -70,8 +72,31 @@ func isStdLib(p string) (bool, error) {
 	return true, nil
 }
 
+// allImports returns the imports of every go file inside the directory of pkg,
+// including test files and files that are excluded by build constraints
+func allImports(pkg *build.Package) []string {
+	imps := append([]string{}, pkg.Imports...)
+	imps = append(imps, pkg.TestImports...)
+	imps = append(imps, pkg.XTestImports...)
+
+	fset := token.NewFileSet()
+	for _, file := range pkg.IgnoredGoFiles {
+		f, err := parser.ParseFile(fset, filepath.Join(pkg.Dir, file), nil, parser.ImportsOnly)
+		if err != nil {
+			// reported when the file is rewritten
+			continue
+		}
+		for _, im := range f.Imports {
+			if p, err := strconv.Unquote(im.Path.Value); err == nil {
+				imps = append(imps, p)
+			}
+		}
+	}
+	return imps
+}
+
 func extImports(pkg *build.Package) ([]string, error) {
-	imps := pkg.Imports
+	imps := allImports(pkg)
 
 	e := []string{}
 
@@ -209,7 +234,9 @@ steps:
 
 // Dependents returns packages inside the given dir
 // that are dependent of the given package, because they import it
-// does not look into directories that begin with the dot
+// does not look into directories that begin with the dot.
+// Imports of test files and of files excluded by build constraints count too,
+// since their import paths have to be rewritten as well.
 func Dependents(dir, p string) ([]string, error) {
 
 	var (
@@ -234,7 +261,9 @@ steps:
 	return walker.deps, err
 }
 
-// DependentsPrefix is like DependentsPrefix, but relPath is a package path, not a directory
+// DependentsPrefix is like DependentsPrefix, but relPath is a package path, not a directory.
+// Like Dependents, it includes packages that import relPath only from test files
+// or files excluded by build constraints.
 func DependentsPrefix(dir, relPath string) ([]string, error) {
 	walker := &dependentsWalker{inSliceFn: inSlicePrefix, relpath: relPath}
 	err := filepath.Walk(dir, walker.Walk)
@@ -358,9 +387,54 @@ func GithubPath(p string) (string, error) {
 	return fmt.Sprintf("github.com%s", p[start:stop]), nil
 }
 
+// gopkginRegexp matches any versioned variant of the given bare gopkg.in path
+// after a quote
+func gopkginRegexp(gopkginBare string) (*regexp.Regexp, error) {
+	return regexp.Compile(`"` + regexp.QuoteMeta(gopkginBare+".v") + `([0-9]+)(\.[0-9]+)*`)
+}
+
+// githubRegexp matches the given github path or a subpackage of it after a quote
+func githubRegexp(github string) (*regexp.Regexp, error) {
+	return regexp.Compile(`"` + regexp.QuoteMeta(github) + `("|/)`)
+}
+
+// replaceAll replaces every match of re in in by repl and returns the number of
+// matches that changed
+func replaceAll(re *regexp.Regexp, in []byte, repl string) ([]byte, int) {
+	return replaceAllFunc(re, in, repl, nil)
+}
+
+// replaceAllFunc is like replaceAll but keeps the matches for which skip returns true
+func replaceAllFunc(re *regexp.Regexp, in []byte, repl string, skip func(m []int) bool) ([]byte, int) {
+	var (
+		out  []byte
+		n    int
+		last int
+	)
+
+	for _, m := range re.FindAllSubmatchIndex(in, -1) {
+		if skip != nil && skip(m) {
+			continue
+		}
+		r := re.Expand(nil, []byte(repl), in, m)
+		if bytes.Equal(r, in[m[0]:m[1]]) {
+			continue
+		}
+		out = append(out, in[last:m[0]]...)
+		out = append(out, r...)
+		last = m[1]
+		n++
+	}
+
+	if n == 0 {
+		return in, 0
+	}
+	return append(out, in[last:]...), n
+}
+
 func replaceGopkgin(gopkginBare string, target string, in []byte) ([]byte, error) {
 	// fmt.Printf("replacing %#v with %#v\n", gopkginBare, target)
-	re, err := regexp.Compile(`"` + regexp.QuoteMeta(gopkginBare+".v") + `([0-9]+)(\.[0-9]+)*`)
+	re, err := gopkginRegexp(gopkginBare)
 	// fmt.Println(re)
 	if err != nil {
 		return nil, err
@@ -371,7 +445,7 @@ func replaceGopkgin(gopkginBare string, target string, in []byte) ([]byte, error
 
 func replaceGithub(github string, target string, in []byte) ([]byte, error) {
 	// fmt.Printf("replacing %#v with %#v\n", github, target)
-	re, err := regexp.Compile(`"` + regexp.QuoteMeta(github) + `("|/)`)
+	re, err := githubRegexp(github)
 	// fmt.Println(re)
 	if err != nil {
 		return nil, err
@@ -381,90 +455,92 @@ func replaceGithub(github string, target string, in []byte) ([]byte, error) {
 }
 
 type replaceImport struct {
-	filepath       string
 	originalImport string
 	targetImport   string
 }
 
-func (r replaceImport) replaceInFile(in []byte) ([]byte, error) {
+func (r replaceImport) replaceInFile(in []byte) ([]byte, int, error) {
 	// fmt.Printf("replacing %#v with %#v\n", gopkginBare, target)
 	re, err := regexp.Compile(`"` + regexp.QuoteMeta(r.originalImport))
 	// fmt.Println(re)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
-	return re.ReplaceAll(in, []byte(`"`+r.targetImport)), nil
+	out, n := replaceAll(re, in, `"`+r.targetImport)
+	return out, n, nil
 }
 
-func (r replaceImport) replace() error {
-	var (
-		err      error
-		original []byte
-		replaced []byte
-	)
+type replaceFile struct {
+	gopkgin string
+	target  string
+	pkgPath string
 
-steps:
-	for jump := 1; err == nil; jump++ {
-		switch jump - 1 {
-		default:
-			break steps
-		case 0:
-			original, err = ioutil.ReadFile(r.filepath)
-		case 1:
-			replaced, err = r.replaceInFile(original)
-		case 2:
-			err = ioutil.WriteFile(r.filepath, replaced, 0644)
-		}
-	}
-	return err
+	// exclude are the paths of subpackages of pkgPath that have their own versions
+	exclude []string
 }
 
-type replaceFile struct {
-	filepath string
-	gopkgin  string
-	target   string
-	pkgPath  string
+// skipsGopkgin reports whether the versioned gopkg.in path inside in, whose version
+// ends at end, is the path of an excluded subpackage
+func (r replaceFile) skipsGopkgin(in []byte, end int) bool {
+	if len(r.exclude) == 0 {
+		return false
+	}
+	return excluded(r.exclude, append([]byte(r.pkgPath), in[end:pathTokenEnd(in, end)]...))
 }
 
-func (r replaceFile) replace() error {
+// skipsGithub reports whether the github path inside in, that starts at start,
+// is the path of an excluded subpackage
+func (r replaceFile) skipsGithub(in []byte, start int) bool {
+	return excluded(r.exclude, in[start:])
+}
 
+func (r replaceFile) replaceInFile(in []byte) (out []byte, sites int, err error) {
 	var (
-		err      error
-		original []byte
-		replaced []byte
+		re *regexp.Regexp
+		n  int
 	)
 
-	// fmt.Printf("replace called for file: %#v %s => %s, %s => %s\n", r.filepath, r.gopkgin, r.target, r.pkgPath, r.target)
-
 steps:
 	for jump := 1; err == nil; jump++ {
 		switch jump - 1 {
 		default:
 			break steps
 		case 0:
-			original, err = ioutil.ReadFile(r.filepath)
+			re, err = gopkginRegexp(r.gopkgin)
 		case 1:
-			replaced, err = replaceGopkgin(r.gopkgin, r.target, original)
-		case 2:
-			if r.pkgPath != "" {
-				replaced, err = replaceGithub(r.pkgPath, r.target, replaced)
+			out, sites = replaceAllFunc(re, in, `"`+r.target, func(m []int) bool {
+				return r.skipsGopkgin(in, m[1])
+			})
+			if r.pkgPath == "" {
+				break steps
 			}
+		case 2:
+			re, err = githubRegexp(r.pkgPath)
 		case 3:
-			err = ioutil.WriteFile(r.filepath, replaced, 0644)
+			src := out
+			out, n = replaceAllFunc(re, src, `"`+r.target+"$1", func(m []int) bool {
+				return r.skipsGithub(src, m[0]+1)
+			})
+			sites += n
 		}
 	}
-	return err
+	return
 }
 
 // ReplaceWithGithubPath takes a pkg pkgDir that is a GithubPath.
 // It replaces inside every file inside every package beneath the given dir
 // an string that references any  gopkg variant of the given package by the github variant
 // It can be used for developement to be able to run the tests, switch back by calling
-// ReplaceWithGopkginPath
+// ReplaceWithGopkginPath or Undevelop. The replaced paths are tracked inside the DevelopFile.
 func ReplaceWithGithubPath(pkgDir string) error {
+	_, err := (&Rewriter{}).ReplaceWithGithubPath(pkgDir)
+	return err
+}
+
+// ReplaceWithGithubPath is like the function ReplaceWithGithubPath but returns the changes
+func (r *Rewriter) ReplaceWithGithubPath(pkgDir string) (c Changes, err error) {
 	var (
-		err     error
 		pkg     *build.Package
 		pkgPath string
 		gopkgin string
@@ -484,45 +560,31 @@ steps:
 			gopkgin, err = bareGoPkginPath(pkgPath)
 		case 3:
 			deps, err = DependentsPrefix(pkgDir, gopkgin)
-		}
-	}
-
-	if err != nil {
-		return err
-	}
-
-	repl := replaceFile{gopkgin: gopkgin, target: pkgPath}
-
-	for _, dep := range deps {
-		dpkg, err := build.Import(dep, pkg.SrcRoot, build.ImportMode(0))
-		if err != nil {
-			return err
-		}
-
-		files := append(dpkg.GoFiles, dpkg.TestGoFiles...)
-		for _, file := range files {
-			repl.filepath = filepath.Join(pkg.SrcRoot, dep, file)
-			if err := repl.replace(); err != nil {
-				return err
+		case 4:
+			repl := replaceFile{gopkgin: gopkgin, target: pkgPath}
+			c, err = r.rewrite(repl, []replaceFile{repl}, pkgDir, pkg.SrcRoot, deps)
+		case 5:
+			if !r.DryRun && len(c) > 0 {
+				err = recordDevelop(pkgDir, []replaceFile{{gopkgin: gopkgin, target: pkgPath}}, c)
 			}
+		case 6:
+			err = r.verifyAfterWrite(c)
 		}
 	}
-
-	return nil
+	return
 }
 
-/*
-type replaceImport struct {
-	filepath       string
-	originalImport string
-	targetImport   string
+// ReplaceImport replaces the import path original and its subpackages by target
+// in every package beneath pkgDir
+func ReplaceImport(pkgDir, original, target string) error {
+	_, err := (&Rewriter{}).ReplaceImport(pkgDir, original, target)
+	return err
 }
-*/
 
-func ReplaceImport(pkgDir, original, target string) (err error) {
+// ReplaceImport is like the function ReplaceImport but returns the changes
+func (r *Rewriter) ReplaceImport(pkgDir, original, target string) (c Changes, err error) {
 	var (
 		pkg  *build.Package
-		dpkg *build.Package
 		deps []string
 	)
 
@@ -540,21 +602,9 @@ steps:
 				originalImport: original,
 				targetImport:   target,
 			}
-
-			for _, dep := range deps {
-				dpkg, err = build.Import(dep, pkg.SrcRoot, build.ImportMode(0))
-				if err != nil {
-					return
-				}
-
-				files := append(dpkg.GoFiles, dpkg.TestGoFiles...)
-				for _, file := range files {
-					repl.filepath = filepath.Join(pkg.SrcRoot, dep, file)
-					if err = repl.replace(); err != nil {
-						return
-					}
-				}
-			}
+			c, err = r.rewrite(repl, nil, pkgDir, pkg.SrcRoot, deps)
+		case 3:
+			err = r.verifyAfterWrite(c)
 		}
 	}
 
@@ -568,15 +618,20 @@ steps:
 // It can be used to release a package after ReplaceWithGithubPath has been used or to update
 // a version number
 func ReplaceWithGopkginPath(pkgdir string, version [3]int) error {
+	_, err := (&Rewriter{}).ReplaceWithGopkginPath(pkgdir, version)
+	return err
+}
+
+// ReplaceWithGopkginPath is like the function ReplaceWithGopkginPath but returns the changes
+func (r *Rewriter) ReplaceWithGopkginPath(pkgdir string, version [3]int) (c Changes, err error) {
 	// fmt.Printf("ReplaceWithGopkginPath(%#v, %v)\n", pkgdir, version)
-	// fmt.Printf("ReplaceWithGithubPath(%#v)\n", pkgDir)
 	var (
-		err     error
 		pkg     *build.Package
 		pkgPath string
 		gopkgin string
 		target  string
 		deps    []string
+		exclude []string
 	)
 
 steps:
@@ -598,36 +653,23 @@ steps:
 			var addDeps []string
 			addDeps, err = DependentsPrefix(pkgdir, gopkgin)
 			deps = append(deps, addDeps...)
-		}
-	}
-
-	if err != nil {
-		// fmt.Printf("err1: %s\n", err)
-		return err
-	}
-
-	// fmt.Printf("deps: %#v\n", deps)
-
-	repl := replaceFile{gopkgin: gopkgin, target: target, pkgPath: pkgPath}
-
-	for _, dep := range deps {
-		dpkg, err := build.Import(dep, pkg.SrcRoot, build.ImportMode(0))
-		if err != nil {
-			// fmt.Printf("err2: %s\n", err)
-			return err
-		}
-
-		files := append(dpkg.GoFiles, dpkg.TestGoFiles...)
-
-		for _, file := range files {
-			repl.filepath = filepath.Join(pkg.SrcRoot, dep, file)
-			// fmt.Printf("replace %s\n", repl.filepath)
-			if err := repl.replace(); err != nil {
-				return err
+		case 6:
+			// subpackages with their own tag prefix keep their paths
+			exclude, err = versionedPackages(pkgdir)
+		case 7:
+			// fmt.Printf("deps: %#v\n", deps)
+			repl := replaceFile{gopkgin: gopkgin, target: target, pkgPath: pkgPath, exclude: exclude}
+			c, err = r.rewrite(repl, []replaceFile{repl}, pkgdir, pkg.SrcRoot, deps)
+		case 8:
+			// the github paths are gone, so develop mode is left
+			if !r.DryRun {
+				err = leaveDevelop(pkgdir)
 			}
+		case 9:
+			err = r.verifyAfterWrite(c)
 		}
 	}
-	return nil
+	return
 }
 
 type sortVersion [][3]int
@@ -668,7 +710,7 @@ func VersionString(version [3]int) string {
 }
 
 // LastVersion returns the last version of a version slice like this
-// []string{"v1","v5", "v1.10"}
+// []string{"v1","v5", "v1.10"}. It returns ErrNoVersionTag, if none of them is a version.
 func LastVersion(versions ...string) ([3]int, error) {
 	var v [][3]int
 
@@ -682,6 +724,10 @@ func LastVersion(versions ...string) ([3]int, error) {
 		v = append(v, vv)
 	}
 
+	if len(v) == 0 {
+		return [3]int{}, ErrNoVersionTag
+	}
+
 	last := lastVersion(v...)
 
 	if last[0] == 0 && last[1] == 0 && last[2] == 0 {
@@ -695,8 +741,9 @@ func gitTags(tr *gitlib.Transaction) (tags []string, err error) {
 	return tr.Tags()
 }
 
-// lastVersionFromTag returns the last version from the tag of the repository
-func lastVersionFromTag(tr *gitlib.Transaction) ([3]int, error) {
+// lastVersionFromTag returns the last version from the tags of the repository
+// that have the given prefix
+func lastVersionFromTag(tr *gitlib.Transaction, prefix string) ([3]int, error) {
 	var v [3]int
 	tags, err := gitTags(tr)
 
@@ -704,17 +751,35 @@ func lastVersionFromTag(tr *gitlib.Transaction) ([3]int, error) {
 		return v, err
 	}
 
-	return LastVersion(tags...)
+	return LastVersion(trimTagPrefix(tags, prefix)...)
 }
 
-func setTag(tr *gitlib.Transaction, tag string) error {
-	sha1, err := tr.GetSymbolicRef("HEAD")
+// lastVersionAt returns the last version from the tags with the given prefix
+// that are reachable from rev inside dir, from all tags if rev is empty
+func lastVersionAt(dir, rev, prefix string) ([3]int, error) {
+	var v [3]int
+	args := []string{"tag"}
+	if rev != "" {
+		args = append(args, "--merged", rev)
+	}
+	tags, err := gitLines(dir, args...)
 
 	if err != nil {
-		return err
+		return v, err
 	}
 
-	return tr.Tag(tag, sha1, "")
+	return LastVersion(trimTagPrefix(tags, prefix)...)
+}
+
+// trimTagPrefix returns the tags with the given prefix without the prefix
+func trimTagPrefix(tags []string, prefix string) []string {
+	var versions []string
+	for _, t := range tags {
+		if strings.HasPrefix(t, prefix) {
+			versions = append(versions, t[len(prefix):])
+		}
+	}
+	return versions
 }
 
 func gitPushTags(tr *gitlib.Transaction) error {
@@ -722,33 +787,71 @@ func gitPushTags(tr *gitlib.Transaction) error {
 }
 
 func SetNewMajor(dir string) ([3]int, error) {
-	return setNewVersion(dir, 0)
+	v, _, err := setNewVersion(&Rewriter{}, dir, 0)
+	return v, err
 }
 
 func SetNewMinor(dir string) ([3]int, error) {
-	return setNewVersion(dir, 1)
+	v, _, err := setNewVersion(&Rewriter{}, dir, 1)
+	return v, err
 }
 
 func SetNewPatch(dir string) ([3]int, error) {
-	return setNewVersion(dir, 2)
+	v, _, err := setNewVersion(&Rewriter{}, dir, 2)
+	return v, err
+}
+
+// SetNewMajor is like the function SetNewMajor but returns the changes
+func (r *Rewriter) SetNewMajor(dir string) ([3]int, Changes, error) {
+	return setNewVersion(r, dir, 0)
+}
+
+// SetNewMinor is like the function SetNewMinor but returns the changes
+func (r *Rewriter) SetNewMinor(dir string) ([3]int, Changes, error) {
+	return setNewVersion(r, dir, 1)
+}
+
+// SetNewPatch is like the function SetNewPatch but returns the changes
+func (r *Rewriter) SetNewPatch(dir string) ([3]int, Changes, error) {
+	return setNewVersion(r, dir, 2)
 }
 
 func PushNewMajor(dir string) ([3]int, error) {
-	return pushNewVersion(dir, 0)
+	return pushNewVersion(&Pusher{}, dir, 0)
 }
 
 func PushNewMinor(dir string) ([3]int, error) {
-	return pushNewVersion(dir, 1)
+	return pushNewVersion(&Pusher{}, dir, 1)
 }
 
 func PushNewPatch(dir string) ([3]int, error) {
-	return pushNewVersion(dir, 2)
+	return pushNewVersion(&Pusher{}, dir, 2)
+}
+
+// PushNewMajor is like the function PushNewMajor but tags with the options of the Pusher
+func (p *Pusher) PushNewMajor(dir string) ([3]int, error) {
+	return pushNewVersion(p, dir, 0)
+}
+
+// PushNewMinor is like the function PushNewMinor but tags with the options of the Pusher
+func (p *Pusher) PushNewMinor(dir string) ([3]int, error) {
+	return pushNewVersion(p, dir, 1)
+}
+
+// PushNewPatch is like the function PushNewPatch but tags with the options of the Pusher
+func (p *Pusher) PushNewPatch(dir string) ([3]int, error) {
+	return pushNewVersion(p, dir, 2)
 }
 
 type newVersion struct {
-	version [3]int
-	level   int
-	dir     string
+	version  [3]int
+	level    int
+	dir      string
+	prefix   string
+	rev      string // the tagged commit, HEAD if it is empty
+	rewriter *Rewriter
+	changes  Changes
+	pusher   *Pusher
 }
 
 func (n *newVersion) push(tr *gitlib.Transaction) (err error) {
@@ -758,6 +861,8 @@ func (n *newVersion) push(tr *gitlib.Transaction) (err error) {
 		pkgPath     string
 		gopkginPath string
 		getVersion  [3]int
+		last        [3]int
+		undo        []undoStep
 	)
 
 steps:
@@ -766,26 +871,63 @@ steps:
 		default:
 			break steps
 		case 0:
-			n.version, err = lastVersionFromTag(tr)
+			err = n.pusher.runGatesAt(n.dir, n.rev)
 		case 1:
-			n.setVersion()
-			err = setTag(tr, VersionString(n.version))
+			last, err = lastVersionAt(n.dir, n.rev, n.prefix)
+			n.version = last
 		case 2:
-			err = tr.PushTags()
+			n.setVersion()
+			tag := n.tag()
+			if err = n.pusher.tag(n.dir, tag, n.rev); err == nil {
+				undo = append(undo, n.pusher.undoTag(n.dir, tag))
+			}
 		case 3:
+			if n.pusher.MajorBranch {
+				var u *undoStep
+				if u, err = n.pusher.updateMajorBranch(n.dir, majorBranch(n.prefix, n.version), n.rev); u != nil {
+					undo = append(undo, *u)
+				}
+			}
+		case 4:
+			tag := n.tag()
+			undo, err = n.pusher.pushAll(n.dir, "tag "+tag, undo, func(remote string) (*undoStep, error) {
+				return n.pusher.pushTag(n.dir, remote, tag)
+			})
+		case 5:
+			if n.pusher.MajorBranch {
+				branch := majorBranch(n.prefix, n.version)
+				undo, err = n.pusher.pushAll(n.dir, "branch "+branch, undo, func(remote string) (*undoStep, error) {
+					return n.pusher.pushMajorBranch(n.dir, remote, branch)
+				})
+			}
+		case 6:
+			// gopkg.in can't serve packages with a tag prefix, they are imported by their github path
+			if n.prefix != "" {
+				break steps
+			}
 			getVersion[0] = n.version[0]
 			pkg, err = Pkg(n.dir)
-		case 4:
+		case 7:
 			pkgPath, err = PkgPath(pkg)
-		case 5:
+		case 8:
 			gopkginPath, err = GoPkginPath(pkgPath, getVersion)
-		case 6:
+		case 9:
 			err = GoGetAndInstall(pkg.SrcRoot, gopkginPath)
 		}
 	}
+
+	if err != nil {
+		n.version = last
+		err = rollback(err, undo)
+	}
 	return
 }
 
+// tag returns the tag of the version, e.g. v1.2 or sub/v1.2
+func (n *newVersion) tag() string {
+	return n.prefix + VersionString(n.version)
+}
+
 func (n *newVersion) setVersion() {
 	switch n.level {
 	case 0:
@@ -801,6 +943,10 @@ func (n *newVersion) setVersion() {
 }
 
 func (n *newVersion) setVersionInFiles(tr *gitlib.Transaction) (err error) {
+	// the paths and the changelog are written together
+	dry := *n.rewriter
+	dry.DryRun = true
+	dry.Verify = false
 
 steps:
 	for jump := 1; err == nil; jump++ {
@@ -810,13 +956,38 @@ steps:
 
 		case 0:
 			// fmt.Println("get last version")
-			n.version, err = lastVersionFromTag(tr)
+			n.version, err = lastVersionFromTag(tr, n.prefix)
 		case 1:
 			// fmt.Println("ReplaceWithGopkginPath")
 			n.setVersion()
-			var replaceVersion [3]int
-			replaceVersion[0] = n.version[0]
-			err = ReplaceWithGopkginPath(n.dir, replaceVersion)
+			// packages with a tag prefix keep their github path
+			if n.prefix == "" {
+				var replaceVersion [3]int
+				replaceVersion[0] = n.version[0]
+				n.changes, err = dry.ReplaceWithGopkginPath(n.dir, replaceVersion)
+			}
+		case 2:
+			if n.rewriter.Changelog != "" {
+				var f *FileChange
+				if f, err = n.rewriter.changelogChange(n.dir, n.tag()); err == nil {
+					n.changes = append(n.changes, f)
+				}
+			}
+		case 3:
+			err = n.rewriter.verifyBeforeWrite(n.changes)
+		case 4:
+			err = n.rewriter.write(n.dir, n.changes)
+		case 5:
+			// the github paths are gone, so develop mode is left
+			if !n.rewriter.DryRun && n.prefix == "" {
+				err = leaveDevelop(n.dir)
+			}
+		case 6:
+			err = n.rewriter.verifyAfterWrite(n.changes)
+		case 7:
+			if !n.rewriter.DryRun && len(n.changes) > 0 {
+				err = n.rewriter.commitRelease(n.dir, n.tag(), n.changes)
+			}
 		}
 	}
 	return
@@ -825,17 +996,15 @@ steps:
 // setNewVersion does the following:
 // - gets the next version (level = 2 (patch) / 1 (minor)/ 0 (major))
 // - replaces the references inside this package to this version
-// - does a commit with the given message
-// - tags this version
-// - pushes the current branch to the default target, including the new tags
-// - returns the new version and the first error
+// - commits the changed files with the ReleaseMessage of the Rewriter
+// - returns the new version, the changed files and the first error
 //
-func setNewVersion(dir string, level int) ([3]int, error) {
+func setNewVersion(r *Rewriter, dir string, level int) ([3]int, Changes, error) {
 
 	var (
 		err error
 		git *gitlib.Git
-		n   = newVersion{level: level, dir: dir}
+		n   = newVersion{level: level, dir: dir, rewriter: r}
 	)
 
 steps:
@@ -848,20 +1017,22 @@ steps:
 				err = fmt.Errorf("invalid level: %d", level)
 			}
 		case 1:
-			git, err = gitlib.NewGit(dir)
+			n.prefix, err = TagPrefix(dir)
 		case 2:
+			git, err = gitlib.NewGit(dir)
+		case 3:
 			err = git.Transaction(n.setVersionInFiles)
 		}
 	}
-	return n.version, err
+	return n.version, n.changes, err
 }
 
-func pushNewVersion(dir string, level int) ([3]int, error) {
+func pushNewVersion(p *Pusher, dir string, level int) ([3]int, error) {
 
 	var (
 		err error
 		git *gitlib.Git
-		n   = newVersion{level: level, dir: dir}
+		n   = newVersion{level: level, dir: dir, pusher: p}
 	)
 
 steps:
@@ -874,11 +1045,16 @@ steps:
 				err = fmt.Errorf("invalid level: %d", level)
 			}
 		case 1:
+			n.prefix, err = TagPrefix(dir)
+			if err == nil {
+				n.rev, err = p.refCommit(dir)
+			}
+		case 2:
 			git, err = gitlib.NewGit(dir)
 			if DEBUG {
 				git.Debug = true
 			}
-		case 2:
+		case 3:
 			err = git.Transaction(n.push)
 		}
 	}
@@ -0,0 +1,163 @@
+package gpk
+
+import (
+	"bytes"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// importCommentRegexp matches a package clause with an import comment like
+// package foo // import "gopkg.in/x/y.v1"
+var importCommentRegexp = regexp.MustCompile(`(?m)^package[ \t]+[A-Za-z_][A-Za-z0-9_]*[ \t]*//[ \t]*import[ \t]+"[^"\n]*"`)
+
+// importCommentReplacer replaces the path inside the import comment of a file
+// by the same scheme that is used for the imports
+type importCommentReplacer struct {
+	repl replacer
+}
+
+func (i importCommentReplacer) replaceInFile(in []byte) ([]byte, int, error) {
+	loc := importCommentRegexp.FindIndex(in)
+	if loc == nil {
+		return in, 0, nil
+	}
+
+	clause, sites, err := i.repl.replaceInFile(in[loc[0]:loc[1]])
+	if err != nil || sites == 0 {
+		return in, 0, err
+	}
+
+	var out []byte
+	out = append(out, in[:loc[0]]...)
+	out = append(out, clause...)
+	return append(out, in[loc[1]:]...), sites, nil
+}
+
+// addImportComment adds an import comment to the package clause of a file
+// that has none
+type addImportComment struct {
+	path string
+}
+
+func (a addImportComment) replaceInFile(in []byte) ([]byte, int, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", in, parser.PackageClauseOnly)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	end := fset.Position(f.Name.End()).Offset
+	rest := in[end:]
+	if nl := bytes.IndexByte(rest, '\n'); nl != -1 {
+		rest = rest[:nl]
+	}
+
+	// don't touch package clauses that are followed by something else
+	if len(bytes.TrimSpace(rest)) != 0 {
+		return in, 0, nil
+	}
+
+	var out []byte
+	out = append(out, in[:end]...)
+	out = append(out, " // import "+strconv.Quote(a.path)...)
+	return append(out, in[end+len(rest):]...), 1, nil
+}
+
+// repoPackages returns the packages beneath dir. Like Dependents it
+// does not look into directories that begin with the dot
+func repoPackages(dir string) ([]*build.Package, error) {
+	var pkgs []*build.Package
+
+	err := filepath.Walk(dir, func(f string, info os.FileInfo, err error) error {
+		if err != nil || !info.IsDir() {
+			return err
+		}
+		if f != dir && strings.HasPrefix(info.Name(), ".") {
+			return filepath.SkipDir
+		}
+		if pkg, err := Pkg(f); err == nil {
+			pkgs = append(pkgs, pkg)
+		}
+		return nil
+	})
+	return pkgs, err
+}
+
+// commentFile returns the file of pkg that should get the import comment:
+// doc.go if there is one, otherwise the first go file
+func commentFile(pkg *build.Package) string {
+	files := append([]string{}, pkg.GoFiles...)
+	if len(files) == 0 {
+		return ""
+	}
+	sort.Strings(files)
+
+	for _, f := range files {
+		if f == "doc.go" {
+			return f
+		}
+	}
+	return files[0]
+}
+
+// canonicalPath returns the import path of pkg after repl is applied
+func canonicalPath(repl replacer, pkg *build.Package) (string, error) {
+	p, err := PkgPath(pkg)
+	if err != nil {
+		return "", err
+	}
+	p = filepath.ToSlash(p)
+
+	quoted, _, err := repl.replaceInFile([]byte(strconv.Quote(p)))
+	if err != nil {
+		return "", err
+	}
+	return strconv.Unquote(string(quoted))
+}
+
+// importCommentChanges adds the changes of the import comments of every package
+// beneath dir to c. If AddImportComments is set, missing import comments are added.
+func (r *Rewriter) importCommentChanges(repl replacer, dir string, c Changes) (Changes, error) {
+	pkgs, err := repoPackages(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	comment := importCommentReplacer{repl}
+
+	for _, pkg := range pkgs {
+		if pkg.ImportComment != "" {
+			for _, file := range pkg.GoFiles {
+				if c, err = c.apply(comment, dir, filepath.Join(pkg.Dir, file)); err != nil {
+					return nil, err
+				}
+			}
+			continue
+		}
+
+		if !r.AddImportComments || pkg.Name == "main" {
+			continue
+		}
+
+		file := commentFile(pkg)
+		if file == "" {
+			continue
+		}
+
+		var path string
+		if path, err = canonicalPath(repl, pkg); err != nil {
+			return nil, err
+		}
+		if c, err = c.apply(addImportComment{path}, dir, filepath.Join(pkg.Dir, file)); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
@@ -0,0 +1,74 @@
+package gpk
+
+import (
+	"testing"
+)
+
+func TestImportCommentReplacer(t *testing.T) {
+
+	tests := []struct {
+		file     string
+		expected string
+		sites    int
+	}{
+		{
+			"package b // import \"gopkg.in/a/b.v1\"\n\nimport \"gopkg.in/a/b.v1/c\"\n",
+			"package b // import \"github.com/a/b\"\n\nimport \"gopkg.in/a/b.v1/c\"\n",
+			1,
+		},
+		{
+			"package c //import \"gopkg.in/a/b.v1.2/c\"\n",
+			"package c //import \"github.com/a/b/c\"\n",
+			1,
+		},
+		{
+			"// package b // import \"gopkg.in/a/b.v1\"\npackage b\n",
+			"// package b // import \"gopkg.in/a/b.v1\"\npackage b\n",
+			0,
+		},
+	}
+
+	repl := importCommentReplacer{replaceFile{gopkgin: "gopkg.in/a/b", target: "github.com/a/b"}}
+
+	for _, test := range tests {
+		out, sites, err := repl.replaceInFile([]byte(test.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := string(out), test.expected; got != want || sites != test.sites {
+			t.Errorf("replaceInFile(%#v) = %#v, %d; want %#v, %d", test.file, got, sites, want, test.sites)
+		}
+	}
+}
+
+func TestAddImportComment(t *testing.T) {
+
+	tests := []struct {
+		file     string
+		expected string
+		sites    int
+	}{
+		{
+			"// Package b does b\npackage b\n\nimport \"fmt\"\n",
+			"// Package b does b\npackage b // import \"gopkg.in/a/b.v1\"\n\nimport \"fmt\"\n",
+			1,
+		},
+		{
+			"package b // some comment\n",
+			"package b // some comment\n",
+			0,
+		},
+	}
+
+	repl := addImportComment{"gopkg.in/a/b.v1"}
+
+	for _, test := range tests {
+		out, sites, err := repl.replaceInFile([]byte(test.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := string(out), test.expected; got != want || sites != test.sites {
+			t.Errorf("replaceInFile(%#v) = %#v, %d; want %#v, %d", test.file, got, sites, want, test.sites)
+		}
+	}
+}
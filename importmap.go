@@ -0,0 +1,169 @@
+package gpk
+
+import (
+	"bufio"
+	"fmt"
+	"go/build"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ImportMap maps original import paths to their replacements.
+// Subpackages of an original path are mapped to subpackages of the target.
+type ImportMap map[string]string
+
+// MappingReport tells how a single mapping of an ImportMap has been applied
+type MappingReport struct {
+	Original string
+	Target   string
+	Files    int
+	Sites    int
+}
+
+// ReadImportMap reads an import map from a file with lines like
+//
+//	github.com/old/lib github.com/new/lib
+//
+// Empty lines and lines starting with # are ignored.
+func ReadImportMap(file string) (ImportMap, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	m := ImportMap{}
+	sc := bufio.NewScanner(f)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: want original and target, got %#v", file, line, text)
+		}
+		if _, has := m[fields[0]]; has {
+			return nil, fmt.Errorf("%s:%d: duplicate mapping for %s", file, line, fields[0])
+		}
+		m[fields[0]] = fields[1]
+	}
+	return m, sc.Err()
+}
+
+// lookup returns the original path of the most specific mapping for the import path p
+func (m ImportMap) lookup(p string) (string, bool) {
+	var found string
+	for original := range m {
+		if p != original && !strings.HasPrefix(p, original+"/") {
+			continue
+		}
+		if len(original) > len(found) {
+			found = original
+		}
+	}
+	return found, found != ""
+}
+
+// matches reports whether one of the given imports is mapped
+func (m ImportMap) matches(imports []string, _ string) bool {
+	for _, im := range imports {
+		if _, ok := m.lookup(im); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// quotedRegexp matches a quoted string that might be an import path
+var quotedRegexp = regexp.MustCompile(`"[^"\s]+"`)
+
+// importMapReplacer replaces every quoted import path that is mapped by the
+// most specific mapping and counts the replacements per mapping
+type importMapReplacer struct {
+	m       ImportMap
+	reports map[string]*MappingReport
+}
+
+func (r *importMapReplacer) replaceInFile(in []byte) ([]byte, int, error) {
+	var (
+		sites int
+		used  = map[string]bool{}
+	)
+
+	out := quotedRegexp.ReplaceAllFunc(in, func(quoted []byte) []byte {
+		p := string(quoted[1 : len(quoted)-1])
+		original, ok := r.m.lookup(p)
+		if !ok || r.m[original] == original {
+			return quoted
+		}
+		sites++
+		used[original] = true
+		r.reports[original].Sites++
+		return []byte(`"` + r.m[original] + p[len(original):] + `"`)
+	})
+
+	for original := range used {
+		r.reports[original].Files++
+	}
+	return out, sites, nil
+}
+
+// ReplaceImports replaces the import paths of the given map and their subpackages
+// in every package beneath pkgDir, walking the packages only once.
+// If paths of the map are nested, the most specific one wins.
+func ReplaceImports(pkgDir string, m ImportMap) error {
+	_, _, err := (&Rewriter{}).ReplaceImports(pkgDir, m)
+	return err
+}
+
+// ReplaceImports is like the function ReplaceImports but returns the changes and
+// a report for every mapping, sorted by the original path
+func (r *Rewriter) ReplaceImports(pkgDir string, m ImportMap) (c Changes, reports []MappingReport, err error) {
+	var (
+		pkg    *build.Package
+		walker = &dependentsWalker{inSliceFn: m.matches}
+		repl   = &importMapReplacer{m: m, reports: map[string]*MappingReport{}}
+	)
+
+	for original, target := range m {
+		repl.reports[original] = &MappingReport{Original: original, Target: target}
+	}
+
+steps:
+	for jump := 1; err == nil; jump++ {
+		switch jump - 1 {
+		default:
+			break steps
+		case 0:
+			pkg, err = Pkg(pkgDir)
+		case 1:
+			err = filepath.Walk(pkgDir, walker.Walk)
+		case 2:
+			c, err = r.rewrite(repl, nil, pkgDir, pkg.SrcRoot, walker.deps)
+		case 3:
+			for _, rep := range repl.reports {
+				reports = append(reports, *rep)
+			}
+			sort.Sort(mappingReports(reports))
+		case 4:
+			err = r.verifyAfterWrite(c)
+		}
+	}
+	return
+}
+
+type mappingReports []MappingReport
+
+func (m mappingReports) Len() int           { return len(m) }
+func (m mappingReports) Swap(i, j int)      { m[i], m[j] = m[j], m[i] }
+func (m mappingReports) Less(i, j int) bool { return m[i].Original < m[j].Original }
+
+// String returns something like "github.com/a => github.com/b: 2 files, 3 import sites"
+func (m MappingReport) String() string {
+	return fmt.Sprintf("%s => %s: %d files, %d import sites", m.Original, m.Target, m.Files, m.Sites)
+}
@@ -0,0 +1,59 @@
+package gpk
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestReadImportMap(t *testing.T) {
+	f, err := ioutil.TempFile("", "gpk-map")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+
+	f.WriteString("# fork\ngithub.com/a/b   github.com/me/b\n\n  github.com/c/d github.com/me/d  \n")
+	f.Close()
+
+	m, err := ReadImportMap(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(m) != 2 || m["github.com/a/b"] != "github.com/me/b" || m["github.com/c/d"] != "github.com/me/d" {
+		t.Errorf("ReadImportMap() = %#v", m)
+	}
+
+	ioutil.WriteFile(f.Name(), []byte("github.com/a/b\n"), 0644)
+	if _, err := ReadImportMap(f.Name()); err == nil {
+		t.Errorf("ReadImportMap() must fail for a line without target")
+	}
+}
+
+func TestImportMapReplacer(t *testing.T) {
+	m := ImportMap{
+		"github.com/a/b":     "github.com/me/b",
+		"github.com/a/b/sub": "github.com/other/sub",
+		"github.com/c":       "github.com/me/c",
+	}
+
+	repl := &importMapReplacer{m: m, reports: map[string]*MappingReport{}}
+	for original, target := range m {
+		repl.reports[original] = &MappingReport{Original: original, Target: target}
+	}
+
+	in := "import (\n\t\"github.com/a/b\"\n\t\"github.com/a/b/sub/x\"\n\t\"github.com/a/bc\"\n\tc \"github.com/c/d\"\n)\n"
+	expected := "import (\n\t\"github.com/me/b\"\n\t\"github.com/other/sub/x\"\n\t\"github.com/a/bc\"\n\tc \"github.com/me/c/d\"\n)\n"
+
+	out, sites, _ := repl.replaceInFile([]byte(in))
+	if got, want := string(out), expected; got != want || sites != 3 {
+		t.Errorf("replaceInFile(%#v) = %#v, %d; want %#v, %d", in, got, sites, want, 3)
+	}
+
+	for original, rep := range repl.reports {
+		if rep.Files != 1 || rep.Sites != 1 {
+			t.Errorf("report for %s = %v; want 1 file, 1 import site", original, rep)
+		}
+	}
+}
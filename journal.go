@@ -0,0 +1,270 @@
+package gpk
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// JournalFile is the name of the journal inside the directory of a rewrite.
+// It exists only while files are renamed into place or after an interrupted rewrite.
+const JournalFile = ".gpk-journal"
+
+var ErrJournalExists = errors.New("there is an interrupted rewrite, run gpk recover")
+var ErrNoJournal = errors.New("no interrupted rewrite found")
+
+// journalEntry tracks a single file of a rewrite
+type journalEntry struct {
+	// Path is the file that is rewritten
+	Path string
+
+	// Staged is the temp file with the new content
+	Staged string
+
+	// Backup is the temp file with the original content
+	Backup string
+
+	// New is set, if the file did not exist before the rewrite. It has no backup
+	// and is removed by an undo.
+	New bool
+}
+
+// journal records a rewrite, so that it can be finished or undone
+type journal struct {
+	dir     string
+	Entries []journalEntry
+}
+
+func journalPath(dir string) string {
+	return filepath.Join(dir, JournalFile)
+}
+
+// writeTemp writes data to a new temp file beside path, having the mode of path
+// or 0644, if path does not exist
+func writeTemp(path string, suffix string, data []byte) (string, error) {
+	mode := os.FileMode(0644)
+	info, err := os.Stat(path)
+	if err == nil {
+		mode = info.Mode()
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(path), ".gpk-"+filepath.Base(path)+"-"+suffix+"-")
+	if err != nil {
+		return "", err
+	}
+
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if err == nil {
+		err = f.Chmod(mode)
+	}
+	if errClose := f.Close(); err == nil {
+		err = errClose
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// stage writes the new content and a backup of the original content
+// of every change to temp files. Files that don't exist yet have no backup.
+func (j *journal) stage(c Changes) error {
+	for _, f := range c {
+		var (
+			e   = journalEntry{Path: f.Path}
+			err error
+		)
+		if _, err = os.Stat(f.Path); os.IsNotExist(err) {
+			e.New = true
+		} else if e.Backup, err = writeTemp(f.Path, "orig", f.Original); err != nil {
+			return err
+		}
+		j.Entries = append(j.Entries, e)
+		j.Entries[len(j.Entries)-1].Staged, err = writeTemp(f.Path, "staged", f.Replaced)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// save writes the journal to the journal file
+func (j *journal) save() error {
+	data, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(journalPath(j.dir), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		if os.IsExist(err) {
+			return ErrJournalExists
+		}
+		return err
+	}
+
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if errClose := f.Close(); err == nil {
+		err = errClose
+	}
+	return err
+}
+
+// finish renames every staged file into place and removes the backups and the journal
+func (j *journal) finish() error {
+	for _, e := range j.Entries {
+		if _, err := os.Stat(e.Staged); os.IsNotExist(err) {
+			// already renamed
+			continue
+		}
+		if err := os.Rename(e.Staged, e.Path); err != nil {
+			return err
+		}
+	}
+	return j.cleanup()
+}
+
+// undo restores the original files, removes the new files, the temp files and the journal
+func (j *journal) undo() error {
+	for _, e := range j.Entries {
+		if e.New {
+			if err := os.Remove(e.Path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			continue
+		}
+		if e.Backup == "" {
+			continue
+		}
+		if _, err := os.Stat(e.Backup); os.IsNotExist(err) {
+			continue
+		}
+		if err := os.Rename(e.Backup, e.Path); err != nil {
+			return err
+		}
+	}
+	return j.cleanup()
+}
+
+// cleanup removes the remaining temp files and the journal
+func (j *journal) cleanup() error {
+	for _, e := range j.Entries {
+		for _, tmp := range []string{e.Staged, e.Backup} {
+			if tmp == "" {
+				continue
+			}
+			if err := os.Remove(tmp); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	err := os.Remove(journalPath(j.dir))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// commit writes the changes all or nothing: the new contents are staged to temp files
+// and renamed into place, files that don't exist are created. If anything fails,
+// the original files are restored.
+func commit(dir string, c Changes) (err error) {
+	if _, err = os.Stat(journalPath(dir)); err == nil {
+		return ErrJournalExists
+	}
+
+	j := &journal{dir: dir}
+	err = nil
+
+steps:
+	for jump := 1; err == nil; jump++ {
+		switch jump - 1 {
+		default:
+			break steps
+		case 0:
+			err = j.stage(c)
+		case 1:
+			err = j.save()
+			if err == ErrJournalExists {
+				// the journal belongs to another rewrite, only remove our temp files
+				j.cleanupTemp()
+				return
+			}
+		case 2:
+			err = j.finish()
+		}
+	}
+
+	if err != nil {
+		if errUndo := j.undo(); errUndo != nil {
+			return errUndo
+		}
+	}
+	return
+}
+
+// cleanupTemp removes the temp files without touching the journal file
+func (j *journal) cleanupTemp() {
+	for _, e := range j.Entries {
+		os.Remove(e.Staged)
+		os.Remove(e.Backup)
+	}
+}
+
+// readJournal reads the journal of an interrupted rewrite inside dir
+func readJournal(dir string) (*journal, error) {
+	data, err := ioutil.ReadFile(journalPath(dir))
+	if os.IsNotExist(err) {
+		return nil, ErrNoJournal
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	j := &journal{dir: dir}
+	err = json.Unmarshal(data, j)
+	return j, err
+}
+
+// Interrupted returns the files of an interrupted rewrite inside dir, if there is one
+func Interrupted(dir string) ([]string, error) {
+	j, err := readJournal(dir)
+	if err == ErrNoJournal {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]string, len(j.Entries))
+	for i, e := range j.Entries {
+		files[i] = e.Path
+	}
+	return files, nil
+}
+
+// Recover finishes an interrupted rewrite inside dir, or restores the original
+// files if undo is true.
+func Recover(dir string, undo bool) error {
+	j, err := readJournal(dir)
+	if err != nil {
+		return err
+	}
+
+	if undo {
+		return j.undo()
+	}
+	return j.finish()
+}
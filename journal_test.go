@@ -0,0 +1,150 @@
+package gpk
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// tempChanges creates the files a and b inside a temp dir and returns changes for them
+func tempChanges(t *testing.T) (string, Changes) {
+	dir, err := ioutil.TempDir("", "gpk-journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var c Changes
+	for _, name := range []string{"a.go", "b.go"} {
+		p := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(p, []byte("old "+name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		c = append(c, &FileChange{Path: p, Name: name, Original: []byte("old " + name), Replaced: []byte("new " + name), Sites: 1})
+	}
+	return dir, c
+}
+
+func readTempFile(t *testing.T, dir, name string) string {
+	data, err := ioutil.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestCommit(t *testing.T) {
+	dir, c := tempChanges(t)
+	defer os.RemoveAll(dir)
+
+	if err := commit(dir, c); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"a.go", "b.go"} {
+		if got, want := readTempFile(t, dir, name), "new "+name; got != want {
+			t.Errorf("content of %s = %#v; want %#v", name, got, want)
+		}
+	}
+
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 2 {
+		t.Errorf("len(files) = %d // expected: %d", len(files), 2)
+	}
+}
+
+func TestCommitRollback(t *testing.T) {
+	dir, c := tempChanges(t)
+	defer os.RemoveAll(dir)
+
+	// the second file can't be renamed into place
+	c[1].Path = filepath.Join(dir, "missing", "b.go")
+
+	if err := commit(dir, c); err == nil {
+		t.Fatal("commit must fail for a missing file")
+	}
+
+	if got, want := readTempFile(t, dir, "a.go"), "old a.go"; got != want {
+		t.Errorf("content of a.go = %#v; want %#v", got, want)
+	}
+
+	if _, err := os.Stat(journalPath(dir)); !os.IsNotExist(err) {
+		t.Errorf("journal must be removed after a rollback")
+	}
+}
+
+func TestCommitNewFile(t *testing.T) {
+	dir, c := tempChanges(t)
+	defer os.RemoveAll(dir)
+
+	news := &FileChange{Path: filepath.Join(dir, "NEWS"), Name: "NEWS", Replaced: []byte("new NEWS")}
+	if err := commit(dir, append(c, news)); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := readTempFile(t, dir, "NEWS"), "new NEWS"; got != want {
+		t.Errorf("content of NEWS = %#v; want %#v", got, want)
+	}
+
+	// an interrupted rewrite that created the file is undone by removing it
+	os.Remove(news.Path)
+	j := &journal{dir: dir}
+	if err := j.stage(Changes{news}); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.save(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(j.Entries[0].Staged, news.Path); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Recover(dir, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(news.Path); !os.IsNotExist(err) {
+		t.Errorf("NEWS must be removed by the undo")
+	}
+}
+
+func TestRecover(t *testing.T) {
+
+	for _, undo := range []bool{true, false} {
+		dir, c := tempChanges(t)
+
+		// simulate a process that stopped after renaming the first file
+		j := &journal{dir: dir}
+		if err := j.stage(c); err != nil {
+			t.Fatal(err)
+		}
+		if err := j.save(); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(j.Entries[0].Staged, j.Entries[0].Path); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := commit(dir, c); err != ErrJournalExists {
+			t.Errorf("commit() = %v; want %v", err, ErrJournalExists)
+		}
+
+		if err := Recover(dir, undo); err != nil {
+			t.Fatal(err)
+		}
+
+		prefix := "new "
+		if undo {
+			prefix = "old "
+		}
+
+		for _, name := range []string{"a.go", "b.go"} {
+			if got, want := readTempFile(t, dir, name), prefix+name; got != want {
+				t.Errorf("Recover(undo=%v): content of %s = %#v; want %#v", undo, name, got, want)
+			}
+		}
+
+		if err := Recover(dir, undo); err != ErrNoJournal {
+			t.Errorf("Recover() = %v; want %v", err, ErrNoJournal)
+		}
+		os.RemoveAll(dir)
+	}
+}
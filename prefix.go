@@ -0,0 +1,84 @@
+package gpk
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// TagPrefixFile is the file inside the dir of a package that declares the prefix
+// of its version tags, e.g. sub/ for tags like sub/v1.2.0. It allows a repo to hold
+// several packages that are versioned independently. Since gopkg.in can't serve them,
+// such packages keep their github import path and are not installed after the push.
+const TagPrefixFile = ".gpk-tag-prefix"
+
+// TagPrefix returns the prefix of the version tags of the package inside dir
+// or an empty string, if the package declares none
+func TagPrefix(dir string) (string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, TagPrefixFile))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// packageTags returns the tags of the repo inside dir and the tag prefix
+// of the package inside dir. If rev is not empty, only the tags reachable
+// from rev are returned.
+func packageTags(dir, rev string) (tags []string, prefix string, err error) {
+	if prefix, err = TagPrefix(dir); err != nil {
+		return nil, "", err
+	}
+	args := []string{"tag"}
+	if rev != "" {
+		args = append(args, "--merged", rev)
+	}
+	tags, err = gitLines(dir, args...)
+	return tags, prefix, err
+}
+
+// versionedPackages returns the import paths of the packages beneath dir, but not
+// of dir itself, that declare their own tag prefix. They are released on their own
+// and not rewritten by the release of the package inside dir.
+func versionedPackages(dir string) ([]string, error) {
+	var paths []string
+
+	err := filepath.Walk(dir, func(f string, info os.FileInfo, err error) error {
+		if err != nil || !info.IsDir() || f == dir {
+			return err
+		}
+		if strings.HasPrefix(info.Name(), ".") {
+			return filepath.SkipDir
+		}
+		if _, err := os.Stat(filepath.Join(f, TagPrefixFile)); err != nil {
+			return nil
+		}
+		pkg, err := Pkg(f)
+		if err != nil {
+			return nil
+		}
+		p, err := PkgPath(pkg)
+		if err != nil {
+			return err
+		}
+		paths = append(paths, filepath.ToSlash(p))
+		return filepath.SkipDir
+	})
+	return paths, err
+}
+
+// excluded reports whether the import path at the start of in is one of the
+// paths or a subpackage of it
+func excluded(paths []string, in []byte) bool {
+	for _, p := range paths {
+		if bytes.HasPrefix(in, []byte(p)) && pathEnds(in, len(p)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,133 @@
+package gpk
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLastVersionTagPrefix(t *testing.T) {
+	tags := []string{"v2.0", "sub/v1.2", "sub/v1.10", "sub/foo", "other/v3"}
+
+	if tag, version := lastVersionTag(tags, "sub/"); tag != "sub/v1.10" || version != [3]int{1, 10, 0} {
+		t.Errorf("lastVersionTag(sub/) = %#v, %v; want %#v, %v", tag, version, "sub/v1.10", [3]int{1, 10, 0})
+	}
+
+	if tag, _ := lastVersionTag(tags, ""); tag != "v2.0" {
+		t.Errorf("lastVersionTag() = %#v; want %#v", tag, "v2.0")
+	}
+
+	if got, want := majorBranch("sub/", [3]int{1, 10, 0}), "sub/v1"; got != want {
+		t.Errorf("majorBranch() = %#v; want %#v", got, want)
+	}
+}
+
+func TestTagPrefix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gpk-prefix")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if p, err := TagPrefix(dir); err != nil || p != "" {
+		t.Errorf("TagPrefix() without file = %#v, %v; want \"\", nil", p, err)
+	}
+
+	if err = ioutil.WriteFile(filepath.Join(dir, TagPrefixFile), []byte("sub/\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if p, err := TagPrefix(dir); err != nil || p != "sub/" {
+		t.Errorf("TagPrefix() = %#v, %v; want %#v, nil", p, err, "sub/")
+	}
+}
+
+func TestReplaceFileExclude(t *testing.T) {
+	repl := replaceFile{
+		gopkgin: "gopkg.in/a/b",
+		target:  "gopkg.in/a/b.v2",
+		pkgPath: "github.com/a/b",
+		exclude: []string{"github.com/a/b/sub"},
+	}
+
+	in := `import (
+	"github.com/a/b"
+	"github.com/a/b/util"
+	"github.com/a/b/sub"
+	"github.com/a/b/sub/inner"
+	"github.com/a/b/subway"
+	"gopkg.in/a/b.v1/sub"
+	"gopkg.in/a/b.v1/sub/inner"
+	"gopkg.in/a/b.v1/util"
+)`
+
+	want := `import (
+	"gopkg.in/a/b.v2"
+	"gopkg.in/a/b.v2/util"
+	"github.com/a/b/sub"
+	"github.com/a/b/sub/inner"
+	"gopkg.in/a/b.v2/subway"
+	"gopkg.in/a/b.v1/sub"
+	"gopkg.in/a/b.v1/sub/inner"
+	"gopkg.in/a/b.v2/util"
+)`
+
+	out, n, err := repl.replaceInFile([]byte(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != want || n != 4 {
+		t.Errorf("replaceInFile() = %d sites\n%s\nwant 4 sites\n%s", n, out, want)
+	}
+
+	text := "go get github.com/a/b/sub, gopkg.in/a/b.v1/sub and github.com/a/b/util"
+	wantText := "go get github.com/a/b/sub, gopkg.in/a/b.v1/sub and gopkg.in/a/b.v2/util"
+	if out, _, _ := (textReplacer{repl}).replaceInFile([]byte(text)); string(out) != wantText {
+		t.Errorf("textReplacer = %#v; want %#v", string(out), wantText)
+	}
+}
+
+func TestTrimTagPrefix(t *testing.T) {
+	got := trimTagPrefix([]string{"v1.0", "sub/v1.2", "sub/v2"}, "sub/")
+	if len(got) != 2 || got[0] != "v1.2" || got[1] != "v2" {
+		t.Errorf("trimTagPrefix() = %#v; want %#v", got, []string{"v1.2", "v2"})
+	}
+
+	if got := trimTagPrefix([]string{"v1.0", "sub/v1.2"}, ""); len(got) != 2 {
+		t.Errorf("trimTagPrefix() without prefix = %#v; want every tag", got)
+	}
+
+	// the first release of a package with a new prefix
+	if _, err := LastVersion(trimTagPrefix([]string{"v1.0", "other/v1.2"}, "sub/")...); err != ErrNoVersionTag {
+		t.Errorf("LastVersion() without tags of the prefix = %v; want ErrNoVersionTag", err)
+	}
+}
+
+func TestPushPrefixed(t *testing.T) {
+	dir := tempRepo(t, map[string]string{"a.go": "package a\n", "sub/b.go": "package sub\n", "sub/" + TagPrefixFile: "sub/\n"})
+	defer os.RemoveAll(dir)
+	remote := tempRepo(t, map[string]string{"README": "remote\n"})
+	defer os.RemoveAll(remote)
+
+	gitRun(t, dir, "tag", "v1.0")
+	gitRun(t, dir, "tag", "sub/v0.1")
+
+	// the tags are not installed via gopkg.in, which would fail for the temporary repo
+	n := newVersion{
+		level:  2,
+		dir:    filepath.Join(dir, "sub"),
+		prefix: "sub/",
+		pusher: &Pusher{Remotes: []Remote{{Name: remote, Required: true}}},
+	}
+	if err := n.push(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if n.version != [3]int{0, 1, 1} {
+		t.Errorf("version = %v; want %v", n.version, [3]int{0, 1, 1})
+	}
+	if revision(remote, "sub/v0.1.1") != revision(dir, "HEAD") {
+		t.Errorf("tag sub/v0.1.1 has not been pushed")
+	}
+}
@@ -0,0 +1,86 @@
+package gpk
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Remote is a git remote that releases are pushed to
+type Remote struct {
+	Name string
+
+	// Required remotes must accept a push, failed pushes to other
+	// remotes (mirrors) are only reported
+	Required bool
+}
+
+// PushResult is the result of a push to a remote, Err is nil if it succeeded
+type PushResult struct {
+	Remote string
+
+	// Ref describes what has been pushed, e.g. "tag v1.2"
+	Ref string
+	Err error
+}
+
+func (p PushResult) String() string {
+	if p.Err != nil {
+		return fmt.Sprintf("%s: %s: FAILED: %s", p.Remote, p.Ref, p.Err)
+	}
+	return fmt.Sprintf("%s: %s: ok", p.Remote, p.Ref)
+}
+
+// ConfiguredRemotes returns the remotes of the repo inside dir that releases are
+// pushed to. They are configured as required remotes by the multi-valued git config
+// gpk.remote and as optional mirrors by gpk.mirror. If no required remote is configured,
+// the remote of the current branch or origin is required.
+func ConfiguredRemotes(dir string) ([]Remote, error) {
+	var remotes []Remote
+
+	for _, key := range []string{"gpk.remote", "gpk.mirror"} {
+		// git config exits with 1, if the key is not set
+		names, _ := gitLines(dir, "config", "--get-all", key)
+		for _, name := range names {
+			if name = strings.TrimSpace(name); name != "" {
+				remotes = append(remotes, Remote{Name: name, Required: key == "gpk.remote"})
+			}
+		}
+	}
+
+	if len(remotes) == 0 || !remotes[0].Required {
+		remotes = append([]Remote{{Name: pushRemote(dir), Required: true}}, remotes...)
+	}
+	return remotes, nil
+}
+
+// pushAll calls push for every remote of the Pusher, reports the results and
+// adds the returned undo steps to undo. It returns an error, if the push to a
+// required remote failed.
+func (p *Pusher) pushAll(dir, ref string, undo []undoStep, push func(remote string) (*undoStep, error)) ([]undoStep, error) {
+	remotes := p.Remotes
+	if len(remotes) == 0 {
+		var err error
+		if remotes, err = ConfiguredRemotes(dir); err != nil {
+			return undo, err
+		}
+	}
+
+	var failed []string
+	for _, r := range remotes {
+		u, err := push(r.Name)
+		if u != nil {
+			undo = append(undo, *u)
+		}
+		if p.ReportPush != nil {
+			p.ReportPush(PushResult{Remote: r.Name, Ref: ref, Err: err})
+		}
+		if err != nil && r.Required {
+			failed = append(failed, r.Name)
+		}
+	}
+
+	if len(failed) > 0 {
+		return undo, fmt.Errorf("push of %s to %s failed", ref, strings.Join(failed, ", "))
+	}
+	return undo, nil
+}
@@ -0,0 +1,39 @@
+package gpk
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPushAll(t *testing.T) {
+	var reported []string
+	p := &Pusher{
+		Remotes:    []Remote{{Name: "origin", Required: true}, {Name: "mirror"}, {Name: "backup"}},
+		ReportPush: func(res PushResult) { reported = append(reported, res.String()) },
+	}
+
+	push := func(remote string) (*undoStep, error) {
+		if remote == "mirror" {
+			return nil, errors.New("unreachable")
+		}
+		return &undoStep{desc: remote}, nil
+	}
+
+	undo, err := p.pushAll(".", "tag v1.2", nil, push)
+	if err != nil {
+		t.Errorf("pushAll() with a failing mirror = %v; want nil", err)
+	}
+	if len(undo) != 2 || undo[0].desc != "origin" || undo[1].desc != "backup" {
+		t.Errorf("undo = %#v; want origin and backup", undo)
+	}
+
+	expected := []string{"origin: tag v1.2: ok", "mirror: tag v1.2: FAILED: unreachable", "backup: tag v1.2: ok"}
+	if len(reported) != 3 || reported[0] != expected[0] || reported[1] != expected[1] || reported[2] != expected[2] {
+		t.Errorf("reported %#v; want %#v", reported, expected)
+	}
+
+	p.Remotes[1].Required = true
+	if _, err := p.pushAll(".", "tag v1.2", nil, push); err == nil || err.Error() != "push of tag v1.2 to mirror failed" {
+		t.Errorf("pushAll() with a failing required remote = %v; want push of tag v1.2 to mirror failed", err)
+	}
+}
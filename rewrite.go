@@ -0,0 +1,289 @@
+package gpk
+
+import (
+	"bytes"
+	"fmt"
+	"go/build"
+	"go/format"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+)
+
+// FileChange is the change that a rewrite makes to a single file
+type FileChange struct {
+	Path string
+
+	// Name is the path relative to the directory of the rewrite
+	Name string
+
+	Original []byte
+	Replaced []byte
+
+	// Sites is the number of replaced import paths
+	Sites int
+
+	// Category tells, where the file comes from
+	Category FileCategory
+}
+
+// Diff returns the unified diff of the change
+func (f *FileChange) Diff() string {
+	return UnifiedDiff(f.Name, f.Original, f.Replaced)
+}
+
+// Changes are the file changes of a rewrite
+type Changes []*FileChange
+
+// Sites returns the number of replaced import paths in all files
+func (c Changes) Sites() int {
+	var n int
+	for _, f := range c {
+		n += f.Sites
+	}
+	return n
+}
+
+// Diff returns the unified diffs of all changes
+func (c Changes) Diff() string {
+	var buf bytes.Buffer
+	for _, f := range c {
+		buf.WriteString(f.Diff())
+	}
+	return buf.String()
+}
+
+// Summary returns something like "2 files, 5 import sites"
+func (c Changes) Summary() string {
+	return fmt.Sprintf("%d files, %d import sites", len(c), c.Sites())
+}
+
+// replacer replaces import paths inside the content of a file
+type replacer interface {
+	// replaceInFile returns the replaced content and the number of replaced paths
+	replaceInFile(in []byte) ([]byte, int, error)
+}
+
+// Rewriter rewrites import paths inside the packages beneath a directory.
+// The zero value writes the changes to the files.
+type Rewriter struct {
+	// DryRun only computes the changes without writing anything
+	DryRun bool
+
+	// Globs are patterns of non go files like "*.md" or ".travis.yml" where
+	// references to the package path are rewritten by develop and release.
+	// Patterns without a slash match the base name, others the path relative
+	// to the package dir.
+	Globs []string
+
+	// AddImportComments adds import comments to the packages that have none
+	// when develop or release rewrites the import comments
+	AddImportComments bool
+
+	// Verify type-checks every rewritten package from source with go/types.
+	// Packages that don't type-check are reported as VerifyErrors after the
+	// changes have been written.
+	Verify bool
+
+	// RollbackOnError verifies the changes before they are written and writes
+	// nothing, if a rewritten package does not type-check. It requires Verify.
+	RollbackOnError bool
+
+	// Changelog is the file inside the package dir, e.g. CHANGELOG.md, where a release
+	// prepends a section with the commits since the last version tag.
+	// No changelog is written, if it is empty.
+	Changelog string
+
+	// ReleaseMessage is the text/template of the message of the commit of the files
+	// rewritten by a release, executed with a TagMessage. DefaultReleaseMessage is used,
+	// if it is empty.
+	ReleaseMessage string
+}
+
+// depFiles returns every go file inside the directories of the given dependent packages
+// and their categories. It fails with ParseErrors if some of them do not parse.
+func depFiles(srcRoot string, deps []string) ([]string, map[string]FileCategory, error) {
+	var (
+		files []string
+		cats  = map[string]FileCategory{}
+		seen  = map[string]bool{}
+	)
+	for _, dep := range deps {
+		if seen[dep] {
+			continue
+		}
+		seen[dep] = true
+
+		dpkg, err := build.Import(dep, srcRoot, build.ImportMode(0))
+		if err != nil {
+			return nil, nil, err
+		}
+
+		pkgCats, err := fileCategories(dpkg)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for file, cat := range pkgCats {
+			p := filepath.Join(dpkg.Dir, file)
+			files = append(files, p)
+			cats[p] = cat
+		}
+	}
+
+	sort.Strings(files)
+	if errs := checkParse(files); errs != nil {
+		return nil, nil, errs
+	}
+	return files, cats, nil
+}
+
+// setCategories sets the category of every change, files that are not inside
+// cats are either go files with import comments or text files
+func (c Changes) setCategories(cats map[string]FileCategory) {
+	for _, f := range c {
+		switch {
+		case cats[f.Path] != "":
+			f.Category = cats[f.Path]
+		case filepath.Ext(f.Path) == ".go":
+			f.Category = GoFile
+		default:
+			f.Category = TextFile
+		}
+	}
+}
+
+// newFileChange returns the change of file, named relative to dir
+func newFileChange(dir, file string, original, replaced []byte, sites int) *FileChange {
+	name, err := filepath.Rel(dir, file)
+	if err != nil {
+		name = file
+	}
+	return &FileChange{Path: file, Name: name, Original: original, Replaced: replaced, Sites: sites}
+}
+
+// apply applies repl to file and adds the change to c. If file has already been changed,
+// repl is applied to the changed content. The name of a new change is relative to dir.
+func (c Changes) apply(repl replacer, dir, file string) (Changes, error) {
+	for _, f := range c {
+		if f.Path != file {
+			continue
+		}
+		replaced, sites, err := repl.replaceInFile(f.Replaced)
+		if err != nil {
+			return nil, err
+		}
+		f.Replaced = replaced
+		f.Sites += sites
+		return c, nil
+	}
+
+	original, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	replaced, sites, err := repl.replaceInFile(original)
+	if err != nil {
+		return nil, err
+	}
+
+	if sites == 0 || bytes.Equal(original, replaced) {
+		return c, nil
+	}
+	return append(c, newFileChange(dir, file, original, replaced, sites)), nil
+}
+
+// changes computes the changes of repl for the given files
+// the names of the changes are relative to dir
+func (r *Rewriter) changes(repl replacer, dir string, files []string) (c Changes, err error) {
+	for _, file := range files {
+		if c, err = c.apply(repl, dir, file); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// format formats every changed go file like gofmt, which also sorts the
+// imports inside each group of the import block
+func (c Changes) format() error {
+	for _, f := range c {
+		if filepath.Ext(f.Path) != ".go" {
+			continue
+		}
+		formatted, err := format.Source(f.Replaced)
+		if err != nil {
+			return fmt.Errorf("can't format %s: %s", f.Path, err)
+		}
+		f.Replaced = formatted
+	}
+	return nil
+}
+
+// write writes the changes all or nothing, unless DryRun is set.
+// The journal is kept inside dir.
+func (r *Rewriter) write(dir string, c Changes) error {
+	if r.DryRun || len(c) == 0 {
+		return nil
+	}
+	return commit(dir, c)
+}
+
+// replacers applies several replacers one after another
+type replacers []replacer
+
+func (rs replacers) replaceInFile(in []byte) (out []byte, sites int, err error) {
+	out = in
+	for _, repl := range rs {
+		var n int
+		if out, n, err = repl.replaceInFile(out); err != nil {
+			return nil, 0, err
+		}
+		sites += n
+	}
+	return
+}
+
+// rewrite computes the changes of repl for the files of the given dependent packages
+// beneath dir and writes them.
+// If package paths themselves are replaced, pathRepls are the replacements for the
+// files matching the Globs and for the import comments.
+func (r *Rewriter) rewrite(repl replacer, pathRepls []replaceFile, dir, srcRoot string, deps []string) (c Changes, err error) {
+	var (
+		files []string
+		cats  map[string]FileCategory
+	)
+
+steps:
+	for jump := 1; err == nil; jump++ {
+		switch jump - 1 {
+		default:
+			break steps
+		case 0:
+			files, cats, err = depFiles(srcRoot, deps)
+		case 1:
+			c, err = r.changes(repl, dir, files)
+		case 2:
+			for _, pathRepl := range pathRepls {
+				if c, err = r.textChanges(textReplacer{pathRepl}, dir, c); err != nil {
+					break
+				}
+			}
+		case 3:
+			for _, pathRepl := range pathRepls {
+				if c, err = r.importCommentChanges(pathRepl, dir, c); err != nil {
+					break
+				}
+			}
+		case 4:
+			c.setCategories(cats)
+			err = c.format()
+		case 5:
+			err = r.verifyBeforeWrite(c)
+		case 6:
+			err = r.write(dir, c)
+		}
+	}
+	return
+}
@@ -0,0 +1,78 @@
+package gpk
+
+import (
+	"testing"
+)
+
+func TestReplaceFileSites(t *testing.T) {
+
+	tests := []struct {
+		file     string
+		expected string
+		sites    int
+	}{
+		{
+			"import (\n\t\"gopkg.in/a/b.v1\"\n\t\"gopkg.in/a/b.v1.2/c\"\n)\n",
+			"import (\n\t\"gopkg.in/a/b.v2\"\n\t\"gopkg.in/a/b.v2/c\"\n)\n",
+			2,
+		},
+		{
+			"import (\n\t\"github.com/a/b\"\n\t\"github.com/a/bc\"\n)\n",
+			"import (\n\t\"gopkg.in/a/b.v2\"\n\t\"github.com/a/bc\"\n)\n",
+			1,
+		},
+		{
+			"import \"fmt\"\n",
+			"import \"fmt\"\n",
+			0,
+		},
+	}
+
+	repl := replaceFile{gopkgin: "gopkg.in/a/b", target: "gopkg.in/a/b.v2", pkgPath: "github.com/a/b"}
+
+	for _, test := range tests {
+		out, sites, err := repl.replaceInFile([]byte(test.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := string(out), test.expected; got != want || sites != test.sites {
+			t.Errorf("replaceInFile(%#v) = %#v, %d; want %#v, %d", test.file, got, sites, want, test.sites)
+		}
+	}
+}
+
+func TestChangesSummary(t *testing.T) {
+	c := Changes{{Sites: 2}, {Sites: 3}}
+
+	if got, want := c.Summary(), "2 files, 5 import sites"; got != want {
+		t.Errorf("Summary() = %#v; want %#v", got, want)
+	}
+}
+
+func TestChangesFormat(t *testing.T) {
+	c := Changes{
+		{
+			Path:     "a.go",
+			Replaced: []byte("package a\n\nimport (\n\t\"gopkg.in/b/c.v1\"\n\t\"github.com/a/b\"\n\n\t\"fmt\"\n)\nfunc  x() {}\n"),
+		},
+		{
+			Path:     "README.md",
+			Replaced: []byte("func  x() {}\n"),
+		},
+	}
+
+	if err := c.format(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"package a\n\nimport (\n\t\"github.com/a/b\"\n\t\"gopkg.in/b/c.v1\"\n\n\t\"fmt\"\n)\n\nfunc x() {}\n",
+		"func  x() {}\n",
+	}
+
+	for i, f := range c {
+		if got, want := string(f.Replaced), expected[i]; got != want {
+			t.Errorf("format() of %s = %#v; want %#v", f.Path, got, want)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package gpk
+
+import (
+	"fmt"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ImportSite is an import spec inside a go file
+type ImportSite struct {
+	// File is the path of the go file relative to the searched dir
+	File   string
+	Line   int
+	Column int
+
+	// Path is the imported path
+	Path string
+
+	// Alias is the local name of the import, "_", "." or empty if there is none
+	Alias string
+
+	// Test is true, if the file is a test file
+	Test bool
+}
+
+// String returns something like `a/b.go:3:2: "github.com/c/d" as e (test)`
+func (s ImportSite) String() string {
+	str := fmt.Sprintf("%s:%d:%d: %s", s.File, s.Line, s.Column, strconv.Quote(s.Path))
+	if s.Alias != "" {
+		str += " as " + s.Alias
+	}
+	if s.Test {
+		str += " (test)"
+	}
+	return str
+}
+
+// matchesPrefix reports whether the import path p is prefix, a subpackage of it or,
+// for gopkg.in paths, a version of it like prefix.v1 or prefix.v1/c
+func matchesPrefix(p, prefix string) bool {
+	if p == prefix || strings.HasPrefix(p, prefix+"/") {
+		return true
+	}
+
+	if !strings.HasPrefix(p, prefix+".v") {
+		return false
+	}
+
+	rest := p[len(prefix)+2:]
+	l := matchVersion([]byte(rest))
+	return l > 0 && (l == len(rest) || rest[l] == '/')
+}
+
+// fileSites returns the import specs of the go file whose paths match prefix
+func fileSites(fset *token.FileSet, file, prefix string) ([]ImportSite, error) {
+	f, err := parser.ParseFile(fset, file, nil, parser.ImportsOnly)
+	if err != nil {
+		return nil, err
+	}
+
+	var sites []ImportSite
+	for _, spec := range f.Imports {
+		p, err := strconv.Unquote(spec.Path.Value)
+		if err != nil || !matchesPrefix(p, prefix) {
+			continue
+		}
+
+		pos := fset.Position(spec.Pos())
+		site := ImportSite{File: file, Line: pos.Line, Column: pos.Column, Path: p}
+		if spec.Name != nil {
+			site.Alias = spec.Name.Name
+		}
+		sites = append(sites, site)
+	}
+	return sites, nil
+}
+
+// ImportSites is like DependentsPrefix, but returns every import spec beneath dir
+// whose path is relPath or a subpackage or gopkg.in version of it, sorted by file and position.
+// Test files and files excluded by build constraints are included.
+func ImportSites(dir, relPath string) ([]ImportSite, error) {
+	pkg, err := Pkg(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	deps, err := DependentsPrefix(dir, relPath)
+	if err != nil {
+		return nil, err
+	}
+
+	files, _, err := depFiles(pkg.SrcRoot, deps)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		sites []ImportSite
+		fset  = token.NewFileSet()
+	)
+
+	for _, file := range files {
+		found, err := fileSites(fset, file, relPath)
+		if err != nil {
+			return nil, err
+		}
+
+		name, err := filepath.Rel(dir, file)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, site := range found {
+			site.File = name
+			site.Test = strings.HasSuffix(file, "_test.go")
+			sites = append(sites, site)
+		}
+	}
+	return sites, nil
+}
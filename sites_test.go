@@ -0,0 +1,46 @@
+package gpk
+
+import (
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFileSites(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gpk-sites")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "a_test.go")
+	src := "package a\n\nimport (\n\t\"fmt\"\n\tb \"gopkg.in/a/b.v1\"\n\t_ \"gopkg.in/a/b.v1/c\"\n\t\"gopkg.in/a/bc.v1\"\n\t\"gopkg.in/a/b.vx\"\n\t\"gopkg.in/a/b/c\"\n)\n"
+	if err := ioutil.WriteFile(file, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	sites, err := fileSites(token.NewFileSet(), file, "gopkg.in/a/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []ImportSite{
+		{File: file, Line: 5, Column: 2, Path: "gopkg.in/a/b.v1", Alias: "b"},
+		{File: file, Line: 6, Column: 2, Path: "gopkg.in/a/b.v1/c", Alias: "_"},
+		{File: file, Line: 9, Column: 2, Path: "gopkg.in/a/b/c"},
+	}
+
+	if !reflect.DeepEqual(sites, expected) {
+		t.Errorf("fileSites() = %#v; want %#v", sites, expected)
+	}
+}
+
+func TestImportSiteString(t *testing.T) {
+	s := ImportSite{File: "a/b_test.go", Line: 3, Column: 2, Path: "github.com/c/d", Alias: "e", Test: true}
+	if got, want := s.String(), `a/b_test.go:3:2: "github.com/c/d" as e (test)`; got != want {
+		t.Errorf("String() = %#v; want %#v", got, want)
+	}
+}
@@ -0,0 +1,160 @@
+package gpk
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// stepNames are the names of the release steps by level
+var stepNames = [3]string{"major", "minor", "patch"}
+
+// StepLevel returns the level of the step named major, minor or patch
+func StepLevel(step string) (int, error) {
+	for level, name := range stepNames {
+		if name == step {
+			return level, nil
+		}
+	}
+	return -1, fmt.Errorf("unsupported step: %s", step)
+}
+
+// Commit is a commit since the last release
+type Commit struct {
+	Hash    string
+	Subject string
+
+	// Type is the lower cased conventional commit type like feat or fix,
+	// it is empty for other commit messages
+	Type string
+
+	// Level is the level of the step the commit requires
+	// (0 = major, 1 = minor, 2 = patch)
+	Level int
+}
+
+// StepSuggestion is the step suggested by the conventional commit messages
+// since the last release
+type StepSuggestion struct {
+	// Since is the tag of the last release, it is empty if there is none
+	Since string
+
+	Step  string
+	Level int
+
+	// Commits are the commits that decided the step
+	Commits []Commit
+}
+
+var conventionalRegexp = regexp.MustCompile(`^([a-zA-Z]+)(\([^)]*\))?(!)?:`)
+
+// commitType returns the lower cased type of the conventional commit message or
+// an empty string, if it is none
+func commitType(message string) string {
+	m := conventionalRegexp.FindStringSubmatch(message)
+	if m == nil {
+		return ""
+	}
+	return strings.ToLower(m[1])
+}
+
+// commitLevel returns the level of the step that the conventional commit message requires:
+// 0 (major) for a "!" after the type or a BREAKING CHANGE footer,
+// 1 (minor) for the type feat and 2 (patch) for everything else
+func commitLevel(message string) int {
+	lines := strings.Split(strings.TrimSpace(message), "\n")
+
+	for _, line := range lines[1:] {
+		if strings.HasPrefix(line, "BREAKING CHANGE:") || strings.HasPrefix(line, "BREAKING-CHANGE:") {
+			return 0
+		}
+	}
+
+	m := conventionalRegexp.FindStringSubmatch(lines[0])
+	switch {
+	case m == nil:
+		return 2
+	case m[3] == "!":
+		return 0
+	case strings.ToLower(m[1]) == "feat":
+		return 1
+	default:
+		return 2
+	}
+}
+
+// suggestStep returns the suggestion for the given commits
+func suggestStep(since string, commits []Commit) *StepSuggestion {
+	s := &StepSuggestion{Since: since, Level: 2}
+	for _, c := range commits {
+		if c.Level < s.Level {
+			s.Level = c.Level
+		}
+	}
+
+	for _, c := range commits {
+		if c.Level == s.Level {
+			s.Commits = append(s.Commits, c)
+		}
+	}
+	s.Step = stepNames[s.Level]
+	return s
+}
+
+// commitsBetween returns the commits of the repo inside dir that are reachable
+// from the revision to, but not from the revision from. All commits up to to
+// are returned, if from is empty.
+func commitsBetween(dir, from, to string) ([]Commit, error) {
+	rev := to
+	if from != "" {
+		rev = from + ".." + to
+	}
+
+	// commits are separated by \x1e, hash and message by \x1f
+	out, err := gitCmd(dir, "log", "--format=%H%x1f%B%x1e", rev)
+	if err != nil {
+		return nil, err
+	}
+
+	var commits []Commit
+	for _, record := range strings.Split(out, "\x1e") {
+		fields := strings.SplitN(strings.TrimSpace(record), "\x1f", 2)
+		if len(fields) != 2 {
+			continue
+		}
+		message := strings.TrimSpace(fields[1])
+		commits = append(commits, Commit{
+			Hash:    fields[0],
+			Subject: strings.SplitN(message, "\n", 2)[0],
+			Type:    commitType(message),
+			Level:   commitLevel(message),
+		})
+	}
+	return commits, nil
+}
+
+// SuggestStep parses the conventional commit messages since the last version tag
+// of the repo inside dir and suggests the step of the next release
+func SuggestStep(dir string) (*StepSuggestion, error) {
+	return SuggestStepAt(dir, "")
+}
+
+// SuggestStepAt is like SuggestStep, but for the release of the branch or commit rev
+// instead of HEAD. Only the version tags that are reachable from rev are considered.
+func SuggestStepAt(dir, rev string) (*StepSuggestion, error) {
+	tags, prefix, err := packageTags(dir, rev)
+	if err != nil {
+		return nil, err
+	}
+
+	if rev == "" {
+		rev = "HEAD"
+	}
+
+	tag, _ := lastVersionTag(tags, prefix)
+	commits, err := commitsBetween(dir, tag, rev)
+	if err != nil {
+		return nil, err
+	}
+	return suggestStep(tag, commits), nil
+}
@@ -0,0 +1,82 @@
+package gpk
+
+import (
+	"os"
+	"testing"
+)
+
+func TestCommitLevel(t *testing.T) {
+	tests := []struct {
+		message string
+		level   int
+	}{
+		{"fix: handle empty files", 2},
+		{"feat: add usage report", 1},
+		{"Feat(cmd): add usage report", 1},
+		{"feat!: drop Go 1.0", 0},
+		{"refactor(parser)!: rename Parse", 0},
+		{"fix: rename\n\nBREAKING CHANGE: Parse is now Read", 0},
+		{"docs: typo", 2},
+		{"update readme", 2},
+		{"feature: no conventional type", 2},
+	}
+
+	for _, test := range tests {
+		if got := commitLevel(test.message); got != test.level {
+			t.Errorf("commitLevel(%#v) = %d; want %d", test.message, got, test.level)
+		}
+	}
+}
+
+func TestSuggestStep(t *testing.T) {
+	commits := []Commit{
+		{Hash: "a", Subject: "fix: x", Level: 2},
+		{Hash: "b", Subject: "feat: y", Level: 1},
+		{Hash: "c", Subject: "feat: z", Level: 1},
+	}
+
+	s := suggestStep("v1.2", commits)
+	if s.Step != "minor" || s.Level != 1 || len(s.Commits) != 2 || s.Commits[0].Hash != "b" {
+		t.Errorf("suggestStep() = %#v; want minor decided by b and c", s)
+	}
+
+	if s := suggestStep("", nil); s.Step != "patch" || len(s.Commits) != 0 {
+		t.Errorf("suggestStep() without commits = %#v; want patch", s)
+	}
+}
+
+func TestLastVersionTag(t *testing.T) {
+	tag, version := lastVersionTag([]string{"v1.10", "foo", "v1.9.3", "v1.10.1", "v0.1"}, "")
+	if tag != "v1.10.1" || version != [3]int{1, 10, 1} {
+		t.Errorf("lastVersionTag() = %#v, %v; want %#v, %v", tag, version, "v1.10.1", [3]int{1, 10, 1})
+	}
+
+	if tag, _ := lastVersionTag([]string{"foo"}, ""); tag != "" {
+		t.Errorf("lastVersionTag() = %#v; want \"\"", tag)
+	}
+}
+
+func TestSuggestStepAt(t *testing.T) {
+	dir := tempRepo(t, map[string]string{"a.go": "package a\n"})
+	defer os.RemoveAll(dir)
+
+	gitRun(t, dir, "tag", "v1.4")
+	gitRun(t, dir, "checkout", "-q", "-b", "maint")
+	commitFile(t, dir, "a.go", "package a // fix\n", "fix: x")
+	gitRun(t, dir, "checkout", "-q", "-")
+	commitFile(t, dir, "a.go", "package a // feat\n", "feat!: y")
+	gitRun(t, dir, "tag", "v2.0")
+	commitFile(t, dir, "a.go", "package a // feat 2\n", "feat: z")
+
+	s, err := SuggestStepAt(dir, "maint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Since != "v1.4" || s.Step != "patch" || len(s.Commits) != 1 || s.Commits[0].Subject != "fix: x" {
+		t.Errorf("SuggestStepAt(maint) = %#v; want patch since v1.4 decided by fix: x", s)
+	}
+
+	if s, err = SuggestStep(dir); err != nil || s.Since != "v2.0" || s.Step != "minor" {
+		t.Errorf("SuggestStep() = %#v, %v; want minor since v2.0", s, err)
+	}
+}
@@ -0,0 +1,267 @@
+package gpk
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"text/template"
+	"time"
+)
+
+var ErrNoVersionTag = errors.New("no version tag found")
+
+// DefaultReleaseMessage is the template of the message of the commit of a release,
+// if the Rewriter has none
+const DefaultReleaseMessage = "release {{.Version}}"
+
+// DefaultTagMessage is the template of the message of a release tag, if the
+// Pusher has none
+const DefaultTagMessage = "{{.Version}} ({{.Date}})\n\n{{.Changelog}}"
+
+// TagMessage is passed to the templates of the messages of a release tag and commit
+type TagMessage struct {
+	// Version is the tag, e.g. v1.2
+	Version string
+
+	// Date is the date of the release, like 2006-01-02
+	Date string
+
+	// Changelog is a summary of the commits since the last version tag, grouped by their type
+	Changelog string
+}
+
+// Pusher tags new versions and pushes them.
+// The zero value creates unsigned annotated tags with the DefaultTagMessage
+// and runs no gates.
+type Pusher struct {
+	// Message is the text/template of the tag message, executed with a TagMessage
+	Message string
+
+	// Sign signs the tags with the key of the git configuration (user.signingkey),
+	// gpg.format decides whether GPG or SSH is used
+	Sign bool
+
+	// Gates run in order before anything is tagged, the first failing gate aborts the push
+	Gates []Gate
+
+	// Report is called with the result of every gate, if it is not nil
+	Report func(GateResult)
+
+	// RollbackRemote deletes the tag from the remote too, if the push or the
+	// installation fails. The local tag is always deleted.
+	RollbackRemote bool
+
+	// MajorBranch creates or fast-forwards the branch of the major version, e.g. v2,
+	// to the tagged commit and pushes it. Non fast-forward updates are refused.
+	MajorBranch bool
+
+	// Remotes are the remotes that the tag and the branch are pushed to.
+	// If there are none, the remotes configured by ConfiguredRemotes are used.
+	Remotes []Remote
+
+	// ReportPush is called with the result of every push to a remote, if it is not nil
+	ReportPush func(PushResult)
+
+	// Ref is the branch or commit that is tagged instead of HEAD, e.g. to release
+	// a fix on a maintenance branch. The new version follows the last version tag
+	// that is reachable from Ref. The gates check a worktree of Ref.
+	Ref string
+}
+
+// refCommit returns the commit of the Ref of the Pusher inside dir or an empty
+// string, if there is no Ref
+func (p *Pusher) refCommit(dir string) (string, error) {
+	if p.Ref == "" {
+		return "", nil
+	}
+	if c := revision(dir, p.Ref); c != "" {
+		return c, nil
+	}
+	return "", fmt.Errorf("can't find ref %s", p.Ref)
+}
+
+// undoStep rolls back what a step of a push has done
+type undoStep struct {
+	// desc describes what is rolled back
+	desc string
+	fn   func() error
+}
+
+// rollback undoes the steps in reverse order and adds the result to err.
+// A failing step does not stop the rollback.
+func rollback(err error, undo []undoStep) error {
+	if len(undo) == 0 {
+		return err
+	}
+
+	var done, failed []string
+	for i := len(undo) - 1; i >= 0; i-- {
+		if uerr := undo[i].fn(); uerr != nil {
+			failed = append(failed, fmt.Sprintf("can't roll back %s: %s", undo[i].desc, uerr))
+			continue
+		}
+		done = append(done, undo[i].desc)
+	}
+
+	msg := err.Error()
+	if len(done) > 0 {
+		msg += " (rolled back " + strings.Join(done, ", ") + ")"
+	}
+	if len(failed) > 0 {
+		msg += " (" + strings.Join(failed, ", ") + ")"
+	}
+	return errors.New(msg)
+}
+
+// undoTag returns the step that deletes the local tag
+func (p *Pusher) undoTag(dir, tag string) undoStep {
+	return undoStep{
+		desc: "local tag " + tag,
+		fn: func() error {
+			_, err := gitCmd(dir, "tag", "-d", tag)
+			return err
+		},
+	}
+}
+
+// pushTag pushes the tag to the remote. If RollbackRemote is set,
+// it returns the step that deletes the tag from the remote.
+func (p *Pusher) pushTag(dir, remote, tag string) (*undoStep, error) {
+	ref := "refs/tags/" + tag
+	if _, err := gitCmd(dir, "push", remote, ref+":"+ref); err != nil || !p.RollbackRemote {
+		return nil, err
+	}
+
+	return &undoStep{
+		desc: "tag " + tag + " on " + remote,
+		fn: func() error {
+			_, err := gitCmd(dir, "push", remote, ":"+ref)
+			return err
+		},
+	}, nil
+}
+
+// renderMessage executes the text/template tmpl with m
+func renderMessage(tmpl string, m TagMessage) (string, error) {
+	t, err := template.New("message").Parse(tmpl)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	err = t.Execute(&buf, m)
+	return strings.TrimSpace(buf.String()), err
+}
+
+// render executes the message template of the Pusher with m
+func (p *Pusher) render(m TagMessage) (string, error) {
+	if p.Message == "" {
+		return renderMessage(DefaultTagMessage, m)
+	}
+	return renderMessage(p.Message, m)
+}
+
+// newTagMessage returns the TagMessage for the release of version at rev inside the repo
+// of dir, summarizing the commits since the last version tag of the package inside dir.
+// If rev is empty, the release is at HEAD.
+func newTagMessage(dir, version, rev string) (TagMessage, error) {
+	m := TagMessage{Version: version, Date: time.Now().Format("2006-01-02")}
+	tags, prefix, err := packageTags(dir, rev)
+	if err != nil {
+		return m, err
+	}
+
+	to := rev
+	if to == "" {
+		to = "HEAD"
+	}
+
+	since, _ := lastVersionTag(tags, prefix)
+	section, err := changelogSection(dir, version, since, to)
+	if err != nil {
+		return m, err
+	}
+
+	m.Changelog = section.Summary()
+	return m, nil
+}
+
+// tagMessage returns the message for the tag of version at rev inside the repo of dir
+func (p *Pusher) tagMessage(dir, version, rev string) (string, error) {
+	m, err := newTagMessage(dir, version, rev)
+	if err != nil {
+		return "", err
+	}
+	return p.render(m)
+}
+
+// tag creates the annotated and optionally signed tag for the commit rev of the repo
+// inside dir or for HEAD, if rev is empty
+func (p *Pusher) tag(dir, tag, rev string) error {
+	msg, err := p.tagMessage(dir, tag, rev)
+	if err != nil {
+		return err
+	}
+
+	args := []string{"tag", "-a", "-m", msg, tag}
+	if p.Sign {
+		args[1] = "-s"
+	}
+	if rev != "" {
+		args = append(args, rev)
+	}
+	_, err = gitCmd(dir, args...)
+	return err
+}
+
+// VerifyTag checks the signature of the given tag of the repo inside dir and returns
+// the output of git. If tag is empty, the last version tag of the package inside dir is verified.
+func VerifyTag(dir, tag string) (string, error) {
+	if tag == "" {
+		tags, prefix, err := packageTags(dir, "")
+		if err != nil {
+			return "", err
+		}
+		if tag, _ = lastVersionTag(tags, prefix); tag == "" {
+			return "", ErrNoVersionTag
+		}
+	}
+
+	// git writes the result of the verification to stderr
+	cmd := exec.Command("git", "tag", "-v", tag)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		// the last line is the reason, the lines before are the tag object
+		lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+		return "", fmt.Errorf("can't verify tag %s: %s", tag, lines[len(lines)-1])
+	}
+	return string(out), nil
+}
+
+// commitRelease commits the files changed by the release of the given tag
+// with the ReleaseMessage of the Rewriter
+func (r *Rewriter) commitRelease(dir, tag string, c Changes) error {
+	tmpl := r.ReleaseMessage
+	if tmpl == "" {
+		tmpl = DefaultReleaseMessage
+	}
+
+	m, err := newTagMessage(dir, tag, "")
+	if err != nil {
+		return err
+	}
+
+	msg, err := renderMessage(tmpl, m)
+	if err != nil {
+		return err
+	}
+
+	var files []string
+	for _, f := range c {
+		files = append(files, f.Path)
+	}
+	return gitCommitFiles(dir, msg, files)
+}
@@ -0,0 +1,116 @@
+package gpk
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestRenderTagMessage(t *testing.T) {
+	m := TagMessage{Version: "v1.2", Date: "2014-05-01", Changelog: "Features:\n- feat: b (3333333)\n"}
+
+	tests := []struct {
+		tmpl     string
+		expected string
+	}{
+		{"", "v1.2 (2014-05-01)\n\nFeatures:\n- feat: b (3333333)"},
+		{"release {{.Version}}", "release v1.2"},
+	}
+
+	for _, test := range tests {
+		got, err := (&Pusher{Message: test.tmpl}).render(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != test.expected {
+			t.Errorf("render(%#v) = %#v; want %#v", test.tmpl, got, test.expected)
+		}
+	}
+
+	if _, err := (&Pusher{Message: "{{.Version"}).render(m); err == nil {
+		t.Errorf("render of an invalid template = nil; want error")
+	}
+}
+
+func TestRollback(t *testing.T) {
+	var undone []string
+	step := func(desc string, err error) undoStep {
+		return undoStep{desc: desc, fn: func() error {
+			undone = append(undone, desc)
+			return err
+		}}
+	}
+
+	err := rollback(errors.New("push failed"), []undoStep{step("a", nil), step("b", nil)})
+	if got, want := err.Error(), "push failed (rolled back b, a)"; got != want {
+		t.Errorf("rollback() = %#v; want %#v", got, want)
+	}
+
+	undone = nil
+	err = rollback(errors.New("push failed"), []undoStep{step("a", nil), step("b", errors.New("no remote"))})
+	if got, want := err.Error(), "push failed (rolled back a) (can't roll back b: no remote)"; got != want || len(undone) != 2 {
+		t.Errorf("rollback() = %#v, undone %v; want %#v, undone [b a]", got, undone, want)
+	}
+
+	if err := rollback(errors.New("gate failed"), nil); err.Error() != "gate failed" {
+		t.Errorf("rollback() without steps = %#v; want %#v", err.Error(), "gate failed")
+	}
+}
+
+func TestPushTagRollback(t *testing.T) {
+	dir := tempRepo(t, map[string]string{"a.go": "package a\n"})
+	defer os.RemoveAll(dir)
+	remote := tempRepo(t, map[string]string{"README": "remote\n"})
+	defer os.RemoveAll(remote)
+
+	p := &Pusher{RollbackRemote: true}
+	if err := p.tag(dir, "v1.0", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	undo, err := p.pushTag(dir, remote, "v1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revision(remote, "v1.0") != revision(dir, "HEAD") {
+		t.Fatalf("tag v1.0 has not been pushed")
+	}
+
+	if err = rollback(errors.New("install failed"), []undoStep{p.undoTag(dir, "v1.0"), *undo}); err == nil {
+		t.Fatal("rollback() = nil; want the error")
+	}
+	if revision(remote, "v1.0") != "" || revision(dir, "v1.0") != "" {
+		t.Errorf("tag v1.0 must be deleted locally and on the remote")
+	}
+}
+
+func TestLastVersionAt(t *testing.T) {
+	dir := tempRepo(t, map[string]string{"a.go": "package a\n"})
+	defer os.RemoveAll(dir)
+
+	gitRun(t, dir, "tag", "v1.4.2")
+	gitRun(t, dir, "branch", "maint")
+	commitFile(t, dir, "a.go", "package a // 2\n", "feat!: 2")
+	gitRun(t, dir, "tag", "v2.0")
+
+	p := &Pusher{Ref: "maint"}
+	rev, err := p.refCommit(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, err := lastVersionAt(dir, rev, ""); err != nil || v != [3]int{1, 4, 2} {
+		t.Errorf("lastVersionAt(maint) = %v, %v; want %v", v, err, [3]int{1, 4, 2})
+	}
+
+	// no version tag is reachable at all
+	untagged := tempRepo(t, map[string]string{"a.go": "package a\n"})
+	defer os.RemoveAll(untagged)
+	if _, err := lastVersionAt(untagged, "HEAD", ""); err != ErrNoVersionTag {
+		t.Errorf("lastVersionAt() without tags = %v; want ErrNoVersionTag", err)
+	}
+
+	if _, err := (&Pusher{Ref: "unknown"}).refCommit(dir); err == nil {
+		t.Errorf("refCommit() for an unknown ref = nil error; want error")
+	}
+}
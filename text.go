@@ -0,0 +1,188 @@
+package gpk
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// isPathChar reports whether c may be part of an import path element
+func isPathChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		c == '_' || c == '-' || c == '.'
+}
+
+// pathEnds reports whether a path inside free text ends at position i of in.
+// A dot followed by a non path char ends a sentence, not the path.
+func pathEnds(in []byte, i int) bool {
+	if i == len(in) || !isPathChar(in[i]) {
+		return true
+	}
+	return in[i] == '.' && (i+1 == len(in) || !isPathChar(in[i+1]))
+}
+
+// matchVersion returns the length of a version like 1 or 1.2.3 at the start of in
+func matchVersion(in []byte) int {
+	var i int
+	for {
+		start := i
+		for i < len(in) && in[i] >= '0' && in[i] <= '9' {
+			i++
+		}
+		if i == start {
+			// no digits after the dot
+			if start > 0 {
+				return start - 1
+			}
+			return 0
+		}
+		if i == len(in) || in[i] != '.' {
+			return i
+		}
+		i++
+	}
+}
+
+// replaceTextPath replaces the path inside free text like READMEs, badges or CI configs
+// by target, where the path is not quoted.
+// If versioned is true, path is a bare gopkg.in path that is followed by any version.
+// Paths for which skip returns true are kept, skip gets the start and the end
+// of the path including the version.
+// It returns the number of changed references
+func replaceTextPath(in []byte, path, target string, versioned bool, skip func(start, end int) bool) ([]byte, int) {
+	var (
+		out    []byte
+		n      int
+		last   int
+		needle = []byte(path)
+	)
+
+	if versioned {
+		needle = []byte(path + ".v")
+	}
+
+	for i := 0; i < len(in); {
+		idx := bytes.Index(in[i:], needle)
+		if idx == -1 {
+			break
+		}
+		start := i + idx
+		end := start + len(needle)
+		i = start + 1
+
+		if start > 0 && isPathChar(in[start-1]) {
+			continue
+		}
+
+		if versioned {
+			l := matchVersion(in[end:])
+			if l == 0 {
+				continue
+			}
+			end += l
+		}
+
+		if !pathEnds(in, end) || skip != nil && skip(start, end) {
+			continue
+		}
+
+		if string(in[start:end]) == target {
+			i = end
+			continue
+		}
+
+		out = append(out, in[last:start]...)
+		out = append(out, target...)
+		last = end
+		i = end
+		n++
+	}
+
+	if n == 0 {
+		return in, 0
+	}
+	return append(out, in[last:]...), n
+}
+
+// textReplacer replaces the package path of a replaceFile inside free text
+type textReplacer struct {
+	replaceFile
+}
+
+func (t textReplacer) replaceInFile(in []byte) ([]byte, int, error) {
+	out, sites := replaceTextPath(in, t.gopkgin, t.target, true, func(_, end int) bool {
+		return t.skipsGopkgin(in, end)
+	})
+	if t.pkgPath != "" {
+		var n int
+		src := out
+		out, n = replaceTextPath(src, t.pkgPath, t.target, false, func(start, _ int) bool {
+			return t.skipsGithub(src, start)
+		})
+		sites += n
+	}
+	return out, sites, nil
+}
+
+// matchGlobs reports whether the file with the given slash separated path
+// relative to the rewrite directory matches one of the globs.
+// Globs without a slash are matched against the base name.
+func matchGlobs(globs []string, rel string) bool {
+	for _, glob := range globs {
+		name := rel
+		if !strings.Contains(glob, "/") {
+			name = filepath.Base(rel)
+		}
+		if ok, _ := filepath.Match(glob, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// globFiles returns the files beneath dir that match the Globs of the rewriter.
+// Hidden directories are skipped.
+func (r *Rewriter) globFiles(dir string) ([]string, error) {
+	var files []string
+	if len(r.Globs) == 0 {
+		return nil, nil
+	}
+
+	err := filepath.Walk(dir, func(f string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if f != dir && strings.HasPrefix(info.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(dir, f)
+		if err != nil {
+			return err
+		}
+		if matchGlobs(r.Globs, filepath.ToSlash(rel)) {
+			files = append(files, f)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// textChanges adds the changes of repl for the files matching the Globs to c.
+// If a file has already been changed, repl is applied to the changed content.
+func (r *Rewriter) textChanges(repl replacer, dir string, c Changes) (Changes, error) {
+	files, err := r.globFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range files {
+		if c, err = c.apply(repl, dir, file); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
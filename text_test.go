@@ -0,0 +1,71 @@
+package gpk
+
+import (
+	"testing"
+)
+
+func TestTextReplacer(t *testing.T) {
+
+	tests := []struct {
+		text     string
+		expected string
+		sites    int
+	}{
+		{
+			"go get gopkg.in/a/b.v1\n",
+			"go get gopkg.in/a/b.v2\n",
+			1,
+		},
+		{
+			"[![GoDoc](https://godoc.org/gopkg.in/a/b.v1.3?status.svg)](https://godoc.org/gopkg.in/a/b.v1.3)",
+			"[![GoDoc](https://godoc.org/gopkg.in/a/b.v2?status.svg)](https://godoc.org/gopkg.in/a/b.v2)",
+			2,
+		},
+		{
+			"import \"gopkg.in/a/b.v1/c\" // see github.com/a/b.",
+			"import \"gopkg.in/a/b.v2/c\" // see gopkg.in/a/b.v2.",
+			2,
+		},
+		{
+			"gopkg.in/a/bc.v1 xgopkg.in/a/b.v1 github.com/a/b.git github.com/a/bc gopkg.in/a/b.vx",
+			"gopkg.in/a/bc.v1 xgopkg.in/a/b.v1 github.com/a/b.git github.com/a/bc gopkg.in/a/b.vx",
+			0,
+		},
+		{
+			"gopkg.in/a/b.v2 and gopkg.in/a/b.v2/c",
+			"gopkg.in/a/b.v2 and gopkg.in/a/b.v2/c",
+			0,
+		},
+	}
+
+	repl := textReplacer{replaceFile{gopkgin: "gopkg.in/a/b", target: "gopkg.in/a/b.v2", pkgPath: "github.com/a/b"}}
+
+	for _, test := range tests {
+		out, sites, _ := repl.replaceInFile([]byte(test.text))
+		if got, want := string(out), test.expected; got != want || sites != test.sites {
+			t.Errorf("replaceInFile(%#v) = %#v, %d; want %#v, %d", test.text, got, sites, want, test.sites)
+		}
+	}
+}
+
+func TestMatchGlobs(t *testing.T) {
+
+	tests := []struct {
+		globs    []string
+		rel      string
+		expected bool
+	}{
+		{[]string{"*.md"}, "README.md", true},
+		{[]string{"*.md"}, "docs/intro.md", true},
+		{[]string{".travis.yml"}, ".travis.yml", true},
+		{[]string{"docs/*.md"}, "README.md", false},
+		{[]string{"docs/*.md"}, "docs/intro.md", true},
+		{[]string{"*.md"}, "main.go", false},
+	}
+
+	for _, test := range tests {
+		if got, want := matchGlobs(test.globs, test.rel), test.expected; got != want {
+			t.Errorf("matchGlobs(%#v, %#v) = %v; want %v", test.globs, test.rel, got, want)
+		}
+	}
+}
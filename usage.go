@@ -0,0 +1,176 @@
+package gpk
+
+import (
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"sort"
+)
+
+// IdentUsage is the usage of an exported identifier of a package by its dependents
+type IdentUsage struct {
+	// Name is the name of the identifier, methods and fields are prefixed by their type,
+	// e.g. "Type.Method"
+	Name string
+
+	// Kind is one of func, type, method, field, const and var
+	Kind string
+
+	// Positions are the positions of the references, the file names are relative
+	// to the searched dir
+	Positions []token.Position
+}
+
+// UsageReport lists the exported identifiers of a package that are used by its dependents
+// and the ones that are not used, both sorted by name
+type UsageReport struct {
+	Package string
+	Used    []IdentUsage
+	Unused  []IdentUsage
+}
+
+type identUsages []IdentUsage
+
+func (u identUsages) Len() int           { return len(u) }
+func (u identUsages) Swap(i, j int)      { u[i], u[j] = u[j], u[i] }
+func (u identUsages) Less(i, j int) bool { return u[i].Name < u[j].Name }
+
+type positions []token.Position
+
+func (p positions) Len() int      { return len(p) }
+func (p positions) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+func (p positions) Less(i, j int) bool {
+	if p[i].Filename == p[j].Filename {
+		if p[i].Line == p[j].Line {
+			return p[i].Column < p[j].Column
+		}
+		return p[i].Line < p[j].Line
+	}
+	return p[i].Filename < p[j].Filename
+}
+
+// exportedIdents returns the exported identifiers of pkg, including the exported
+// methods and struct fields of its exported types
+func exportedIdents(pkg *types.Package) map[types.Object]*IdentUsage {
+	idents := map[types.Object]*IdentUsage{}
+	scope := pkg.Scope()
+
+	for _, name := range scope.Names() {
+		obj := scope.Lookup(name)
+		if !obj.Exported() {
+			continue
+		}
+
+		switch o := obj.(type) {
+		case *types.Func:
+			idents[o] = &IdentUsage{Name: name, Kind: "func"}
+		case *types.Const:
+			idents[o] = &IdentUsage{Name: name, Kind: "const"}
+		case *types.Var:
+			idents[o] = &IdentUsage{Name: name, Kind: "var"}
+		case *types.TypeName:
+			idents[o] = &IdentUsage{Name: name, Kind: "type"}
+
+			if named, ok := o.Type().(*types.Named); ok {
+				for i := 0; i < named.NumMethods(); i++ {
+					if m := named.Method(i); m.Exported() {
+						idents[m] = &IdentUsage{Name: name + "." + m.Name(), Kind: "method"}
+					}
+				}
+			}
+
+			switch u := o.Type().Underlying().(type) {
+			case *types.Interface:
+				for i := 0; i < u.NumExplicitMethods(); i++ {
+					if m := u.ExplicitMethod(i); m.Exported() {
+						idents[m] = &IdentUsage{Name: name + "." + m.Name(), Kind: "method"}
+					}
+				}
+			case *types.Struct:
+				for i := 0; i < u.NumFields(); i++ {
+					if f := u.Field(i); f.Exported() {
+						idents[f] = &IdentUsage{Name: name + "." + f.Name(), Kind: "field"}
+					}
+				}
+			}
+		}
+	}
+	return idents
+}
+
+// Usage type-checks every package beneath dir that depends on the package p
+// and reports, which exported identifiers of p they reference
+func Usage(dir, p string) (*UsageReport, error) {
+	var (
+		pkg    *build.Package
+		deps   []string
+		target *types.Package
+		idents map[types.Object]*IdentUsage
+		s      = newSourceImporter(nil)
+		report = &UsageReport{Package: p}
+		err    error
+	)
+
+steps:
+	for jump := 1; err == nil; jump++ {
+		switch jump - 1 {
+		default:
+			break steps
+		case 0:
+			pkg, err = Pkg(dir)
+		case 1:
+			deps, err = DependentsPrefix(dir, p)
+		case 2:
+			target, err = s.ImportFrom(p, dir, 0)
+		case 3:
+			idents = exportedIdents(target)
+			for _, dep := range deps {
+				if dep == p {
+					continue
+				}
+
+				var dpkg *build.Package
+				if dpkg, err = build.Import(dep, pkg.SrcRoot, build.FindOnly); err != nil {
+					break steps
+				}
+
+				info := &types.Info{Uses: map[*ast.Ident]types.Object{}}
+				if errs := s.checkDir(dpkg.Dir, info); len(errs) > 0 {
+					err = fmt.Errorf("%s does not type-check: %s", dep, errs[0])
+					break steps
+				}
+
+				for id, obj := range info.Uses {
+					u, has := idents[obj]
+					if !has {
+						continue
+					}
+					pos := s.fset.Position(id.Pos())
+					if rel, e := filepath.Rel(dir, pos.Filename); e == nil {
+						pos.Filename = rel
+					}
+					u.Positions = append(u.Positions, pos)
+				}
+			}
+		case 4:
+			for _, u := range idents {
+				if len(u.Positions) == 0 {
+					report.Unused = append(report.Unused, *u)
+					continue
+				}
+				sort.Sort(positions(u.Positions))
+				report.Used = append(report.Used, *u)
+			}
+			sort.Sort(identUsages(report.Used))
+			sort.Sort(identUsages(report.Unused))
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
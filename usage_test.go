@@ -0,0 +1,55 @@
+package gpk
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestExportedIdents(t *testing.T) {
+	src := `package a
+
+const C = 1
+
+var v, V int
+
+func F() {}
+
+type T struct {
+	Field int
+	field int
+}
+
+func (T) M() {}
+func (T) m() {}
+
+type I interface {
+	N()
+}
+`
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "a.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pkg, err := (&types.Config{}).Check("a", fset, []*ast.File{f}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, u := range exportedIdents(pkg) {
+		got = append(got, u.Kind+" "+u.Name)
+	}
+	sort.Strings(got)
+
+	expected := "const C,field T.Field,func F,method I.N,method T.M,type I,type T,var V"
+	if strings.Join(got, ",") != expected {
+		t.Errorf("exportedIdents() = %v; want %v", strings.Join(got, ","), expected)
+	}
+}
@@ -0,0 +1,212 @@
+package gpk
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// VerifyErrors are the errors of the packages that don't type-check after a rewrite,
+// mapped by the package dirs
+type VerifyErrors map[string][]error
+
+func (v VerifyErrors) Error() string {
+	var dirs []string
+	for dir := range v {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%d rewritten packages do not type-check:", len(dirs))
+	for _, dir := range dirs {
+		fmt.Fprintf(&buf, "\n%s:", dir)
+		for _, err := range v[dir] {
+			fmt.Fprintf(&buf, "\n\t%s", err)
+		}
+	}
+	return buf.String()
+}
+
+// sourceImporter imports packages from their sources, where the contents of
+// the overlay take precedence over the files on disk
+type sourceImporter struct {
+	ctxt    build.Context
+	fset    *token.FileSet
+	overlay map[string][]byte
+	pkgs    map[string]*types.Package
+}
+
+func newSourceImporter(overlay map[string][]byte) *sourceImporter {
+	s := &sourceImporter{
+		ctxt:    build.Default,
+		fset:    token.NewFileSet(),
+		overlay: overlay,
+		pkgs:    map[string]*types.Package{},
+	}
+	s.ctxt.OpenFile = func(path string) (io.ReadCloser, error) {
+		if data, has := s.overlay[path]; has {
+			return ioutil.NopCloser(bytes.NewReader(data)), nil
+		}
+		return os.Open(path)
+	}
+	return s
+}
+
+// parse parses the given files of dir
+func (s *sourceImporter) parse(dir string, files []string) ([]*ast.File, error) {
+	var parsed []*ast.File
+	for _, file := range files {
+		p := filepath.Join(dir, file)
+		// a nil []byte would be parsed as empty source
+		var src interface{}
+		if data, has := s.overlay[p]; has {
+			src = data
+		}
+		f, err := parser.ParseFile(s.fset, p, src, 0)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, f)
+	}
+	return parsed, nil
+}
+
+// check type-checks the given files as package path and returns all errors.
+// info is filled, if it is not nil.
+func (s *sourceImporter) check(path, dir string, files []string, info *types.Info) (*types.Package, []error) {
+	parsed, err := s.parse(dir, files)
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	var errs []error
+	conf := types.Config{
+		Importer:    s,
+		FakeImportC: true,
+		Error:       func(err error) { errs = append(errs, err) },
+	}
+	pkg, _ := conf.Check(path, s.fset, parsed, info)
+	return pkg, errs
+}
+
+func (s *sourceImporter) Import(path string) (*types.Package, error) {
+	return s.ImportFrom(path, "", 0)
+}
+
+func (s *sourceImporter) ImportFrom(path, dir string, mode types.ImportMode) (*types.Package, error) {
+	if path == "unsafe" {
+		return types.Unsafe, nil
+	}
+
+	bpkg, err := s.ctxt.Import(path, dir, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if pkg, has := s.pkgs[bpkg.ImportPath]; has {
+		if !pkg.Complete() {
+			return nil, fmt.Errorf("import cycle through %s", bpkg.ImportPath)
+		}
+		return pkg, nil
+	}
+
+	// mark as incomplete to detect cycles
+	s.pkgs[bpkg.ImportPath] = types.NewPackage(bpkg.ImportPath, bpkg.Name)
+
+	pkg, errs := s.check(bpkg.ImportPath, bpkg.Dir, append(bpkg.GoFiles, bpkg.CgoFiles...), nil)
+	if len(errs) > 0 {
+		delete(s.pkgs, bpkg.ImportPath)
+		return nil, fmt.Errorf("%s does not type-check: %s", bpkg.ImportPath, errs[0])
+	}
+	s.pkgs[bpkg.ImportPath] = pkg
+	return pkg, nil
+}
+
+// checkDir type-checks the package inside dir including its tests
+func (s *sourceImporter) checkDir(dir string, info *types.Info) []error {
+	bpkg, err := s.ctxt.ImportDir(dir, 0)
+	if err != nil {
+		return []error{err}
+	}
+
+	path := bpkg.ImportPath
+	if path == "." {
+		if rel, err := PkgPath(bpkg); err == nil {
+			path = filepath.ToSlash(rel)
+		}
+	}
+
+	files := append(append([]string{}, bpkg.GoFiles...), bpkg.CgoFiles...)
+	_, errs := s.check(path, bpkg.Dir, append(files, bpkg.TestGoFiles...), info)
+
+	if len(bpkg.XTestGoFiles) > 0 {
+		_, xerrs := s.check(path+"_test", bpkg.Dir, bpkg.XTestGoFiles, info)
+		errs = append(errs, xerrs...)
+	}
+	return errs
+}
+
+// verify type-checks every package that has rewritten go files, using the replaced
+// contents. If onDisk is true, the changes have been written and the files are read from disk.
+func (c Changes) verify(onDisk bool) error {
+	var (
+		overlay = map[string][]byte{}
+		dirs    []string
+	)
+
+	for _, f := range c {
+		if filepath.Ext(f.Path) != ".go" {
+			continue
+		}
+		if !onDisk {
+			overlay[f.Path] = f.Replaced
+		}
+		if dir := filepath.Dir(f.Path); !inSlice(dirs, dir) {
+			dirs = append(dirs, dir)
+		}
+	}
+
+	var (
+		s    = newSourceImporter(overlay)
+		errs = VerifyErrors{}
+	)
+
+	for _, dir := range dirs {
+		if e := s.checkDir(dir, nil); len(e) > 0 {
+			errs[dir] = e
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// verifyBeforeWrite type-checks the rewritten packages before anything is written,
+// if the rewrite should not be kept on errors or it is a dry run
+func (r *Rewriter) verifyBeforeWrite(c Changes) error {
+	if !r.Verify || !r.RollbackOnError && !r.DryRun {
+		return nil
+	}
+	return c.verify(false)
+}
+
+// verifyAfterWrite type-checks the rewritten packages after they have been written,
+// if the rewrite should be kept on errors. It is the last step of every rewrite.
+func (r *Rewriter) verifyAfterWrite(c Changes) error {
+	if !r.Verify || r.RollbackOnError || r.DryRun {
+		return nil
+	}
+	return c.verify(true)
+}
@@ -0,0 +1,66 @@
+package gpk
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func verifyChange(t *testing.T, dir, replaced string) Changes {
+	p := filepath.Join(dir, "a.go")
+	original := "package a\n\nvar X = 1\n"
+	if err := ioutil.WriteFile(p, []byte(original), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return Changes{{Path: p, Name: "a.go", Original: []byte(original), Replaced: []byte(replaced)}}
+}
+
+func TestVerify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gpk-verify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		replaced string
+		ok       bool
+	}{
+		{"package a\n\nvar X = 2\n", true},
+		{"package a\n\nvar X int = \"x\"\n", false},
+		{"package a\n\nimport \"example.invalid/missing\"\n\nvar X = missing.X\n", false},
+	}
+
+	for _, test := range tests {
+		c := verifyChange(t, dir, test.replaced)
+
+		err := c.verify(false)
+		if _, isVerify := err.(VerifyErrors); test.ok && err != nil || !test.ok && !isVerify {
+			t.Errorf("verify(false) for %#v = %v; want ok: %v", test.replaced, err, test.ok)
+		}
+
+		// the original on disk type-checks
+		if err := c.verify(true); err != nil {
+			t.Errorf("verify(true) for %#v = %v; want nil", test.replaced, err)
+		}
+	}
+}
+
+func TestVerifyBeforeWrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gpk-verify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := verifyChange(t, dir, "package a\n\nvar X int = \"x\"\n")
+
+	if err := (&Rewriter{Verify: true}).verifyBeforeWrite(c); err != nil {
+		t.Errorf("verifyBeforeWrite without RollbackOnError = %v; want nil", err)
+	}
+
+	if err := (&Rewriter{Verify: true, RollbackOnError: true}).verifyBeforeWrite(c); err == nil {
+		t.Errorf("verifyBeforeWrite with RollbackOnError = nil; want error")
+	}
+}
@@ -0,0 +1,172 @@
+package gpk
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Version is a version tag of a package
+type Version struct {
+	Tag     string
+	Version [3]int
+
+	// Commit is the tagged commit
+	Commit string
+
+	// Date is the commit date of the tagged commit, like 2006-01-02
+	Date string
+
+	// Invalid tags look like versions, but can't be parsed, e.g. v1.x
+	Invalid bool
+
+	// Skipped is set, if versions between the version before and this one
+	// are missing, e.g. v1.3 after v1.1
+	Skipped bool
+
+	// Duplicate is set, if another version tag points at the same commit
+	Duplicate bool
+}
+
+func (v Version) String() string {
+	var flags []string
+	if v.Invalid {
+		flags = append(flags, "invalid")
+	}
+	if v.Skipped {
+		flags = append(flags, "skipped versions")
+	}
+	if v.Duplicate {
+		flags = append(flags, "duplicate")
+	}
+
+	s := fmt.Sprintf("%s\t%.7s\t%s", v.Tag, v.Commit, v.Date)
+	if len(flags) > 0 {
+		s += "\t(" + strings.Join(flags, ", ") + ")"
+	}
+	return s
+}
+
+// skipsVersions reports whether there are versions missing between prev and v
+func skipsVersions(prev, v [3]int) bool {
+	switch {
+	case v[0] > prev[0]+1:
+		return true
+	case v[0] == prev[0]+1:
+		return v[1] != 0 || v[2] != 0
+	case v[0] < prev[0]:
+		return false
+	case v[1] > prev[1]+1:
+		return true
+	case v[1] == prev[1]+1:
+		return v[2] != 0
+	case v[1] < prev[1]:
+		return false
+	default:
+		return v[2] > prev[2]+1
+	}
+}
+
+// markVersions sets the Skipped and Duplicate flags of the valid versions,
+// that are sorted by version
+func markVersions(versions []Version) {
+	commits := map[string]int{}
+	for _, v := range versions {
+		if !v.Invalid {
+			commits[v.Commit]++
+		}
+	}
+
+	var prev *Version
+	for i := range versions {
+		v := &versions[i]
+		if v.Invalid {
+			continue
+		}
+		v.Duplicate = commits[v.Commit] > 1
+		if prev != nil {
+			v.Skipped = skipsVersions(prev.Version, v.Version)
+		}
+		prev = v
+	}
+}
+
+// tagCommits returns the tagged commits and their dates by the tags of the repo inside dir
+func tagCommits(dir string) (commits, dates map[string]string, err error) {
+	// annotated tags have the commit and its date in the fields with *
+	lines, err := gitLines(dir, "for-each-ref",
+		"--format=%(refname)%1f%(objectname)%1f%(committerdate:short)%1f%(*objectname)%1f%(*committerdate:short)",
+		"refs/tags")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	commits, dates = map[string]string{}, map[string]string{}
+	for _, line := range lines {
+		fields := strings.Split(line, "\x1f")
+		if len(fields) != 5 {
+			continue
+		}
+		tag := strings.TrimPrefix(fields[0], "refs/tags/")
+		commits[tag], dates[tag] = fields[1], fields[2]
+		if fields[3] != "" {
+			commits[tag], dates[tag] = fields[3], fields[4]
+		}
+	}
+	return commits, dates, nil
+}
+
+// Versions returns the version tags of the package inside dir, sorted by version
+// and followed by the invalid version tags
+func Versions(dir string) ([]Version, error) {
+	prefix, err := TagPrefix(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	commits, dates, err := tagCommits(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var tags, invalid []string
+	for tag := range commits {
+		tags = append(tags, tag)
+		if !strings.HasPrefix(tag, prefix+"v") {
+			continue
+		}
+		if _, err := parseVersion(tag[len(prefix):]); err != nil {
+			invalid = append(invalid, tag)
+		}
+	}
+	// sortedVersionTags keeps the order of equal versions
+	sort.Strings(tags)
+	sort.Strings(invalid)
+
+	var versions []Version
+	for _, t := range sortedVersionTags(tags, prefix) {
+		versions = append(versions, Version{Tag: t.tag, Version: t.version, Commit: commits[t.tag], Date: dates[t.tag]})
+	}
+	for _, tag := range invalid {
+		versions = append(versions, Version{Tag: tag, Commit: commits[tag], Date: dates[tag], Invalid: true})
+	}
+
+	markVersions(versions)
+	return versions, nil
+}
+
+// LatestVersion returns the last version tag of the package inside dir
+// or ErrNoVersionTag
+func LatestVersion(dir string) (*Version, error) {
+	versions, err := Versions(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := len(versions) - 1; i >= 0; i-- {
+		if !versions[i].Invalid {
+			return &versions[i], nil
+		}
+	}
+	return nil, ErrNoVersionTag
+}
@@ -0,0 +1,56 @@
+package gpk
+
+import (
+	"testing"
+)
+
+func TestSkipsVersions(t *testing.T) {
+	tests := []struct {
+		prev, v [3]int
+		skips   bool
+	}{
+		{[3]int{1, 1, 0}, [3]int{1, 2, 0}, false},
+		{[3]int{1, 1, 0}, [3]int{1, 3, 0}, true},
+		{[3]int{1, 1, 0}, [3]int{1, 1, 1}, false},
+		{[3]int{1, 1, 0}, [3]int{1, 1, 2}, true},
+		{[3]int{1, 1, 3}, [3]int{1, 2, 0}, false},
+		{[3]int{1, 1, 3}, [3]int{1, 2, 1}, true},
+		{[3]int{1, 4, 2}, [3]int{2, 0, 0}, false},
+		{[3]int{1, 4, 2}, [3]int{2, 1, 0}, true},
+		{[3]int{1, 4, 2}, [3]int{3, 0, 0}, true},
+		{[3]int{1, 2, 0}, [3]int{1, 2, 0}, false},
+	}
+
+	for _, test := range tests {
+		if got := skipsVersions(test.prev, test.v); got != test.skips {
+			t.Errorf("skipsVersions(%v, %v) = %v; want %v", test.prev, test.v, got, test.skips)
+		}
+	}
+}
+
+func TestMarkVersions(t *testing.T) {
+	versions := []Version{
+		{Tag: "v1.0", Version: [3]int{1, 0, 0}, Commit: "a"},
+		{Tag: "v1.1", Version: [3]int{1, 1, 0}, Commit: "b"},
+		{Tag: "v1.1.0", Version: [3]int{1, 1, 0}, Commit: "b"},
+		{Tag: "v1.3", Version: [3]int{1, 3, 0}, Commit: "c"},
+		{Tag: "v1.x", Commit: "c", Invalid: true},
+	}
+
+	markVersions(versions)
+
+	want := []struct{ skipped, duplicate bool }{
+		{false, false},
+		{false, true},
+		{false, true},
+		{true, false},
+		{false, false},
+	}
+
+	for i, w := range want {
+		v := versions[i]
+		if v.Skipped != w.skipped || v.Duplicate != w.duplicate {
+			t.Errorf("%s: skipped = %v, duplicate = %v; want %v, %v", v.Tag, v.Skipped, v.Duplicate, w.skipped, w.duplicate)
+		}
+	}
+}
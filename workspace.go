@@ -0,0 +1,257 @@
+package gpk
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Workspace is a set of repos of interdependent packages that are developed together
+type Workspace struct {
+	// Dir is the directory of the workspace file, changes are named relative to it
+	Dir string
+
+	// Repos are the absolute package dirs of the member repos
+	Repos []string
+}
+
+// ReadWorkspace reads a workspace file, that has a package dir of a member repo per line.
+// Relative dirs are relative to the workspace file.
+// Empty lines and lines starting with # are ignored.
+func ReadWorkspace(file string) (*Workspace, error) {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(abs)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	ws := &Workspace{Dir: filepath.Dir(abs)}
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		dir := strings.TrimSpace(sc.Text())
+		if dir == "" || strings.HasPrefix(dir, "#") {
+			continue
+		}
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(ws.Dir, dir)
+		}
+		ws.Repos = append(ws.Repos, filepath.Clean(dir))
+	}
+	return ws, sc.Err()
+}
+
+// rename names the changes relative to the workspace dir
+func (ws *Workspace) rename(c Changes) {
+	for _, f := range c {
+		if name, err := filepath.Rel(ws.Dir, f.Path); err == nil {
+			f.Name = name
+		}
+	}
+}
+
+// developRepls returns the replacements of the gopkg.in paths by the github paths
+// of every member package
+func (ws *Workspace) developRepls() ([]replaceFile, error) {
+	var repls []replaceFile
+	for _, repo := range ws.Repos {
+		pkg, err := Pkg(repo)
+		if err != nil {
+			return nil, err
+		}
+		pkgPath, err := PkgPath(pkg)
+		if err != nil {
+			return nil, err
+		}
+		gopkgin, err := bareGoPkginPath(pkgPath)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", repo, err)
+		}
+		repls = append(repls, replaceFile{gopkgin: gopkgin, target: pkgPath})
+	}
+	return repls, nil
+}
+
+// DevelopWorkspace switches the gopkg.in paths of every member package to their
+// github paths inside every member repo. The changes of all repos are computed,
+// before anything is written. If a repo can't be written, the repos written before are
+// restored. Every repo tracks its switches like ReplaceWithGithubPath.
+func (r *Rewriter) DevelopWorkspace(ws *Workspace) (c Changes, err error) {
+	var (
+		repls   []replaceFile
+		changes = map[string]Changes{}
+		dry     = *r
+	)
+	dry.DryRun = true
+	// the changes of all repos are verified together
+	dry.Verify = false
+
+steps:
+	for jump := 1; err == nil; jump++ {
+		switch jump - 1 {
+		default:
+			break steps
+		case 0:
+			repls, err = ws.developRepls()
+		case 1:
+			for _, repo := range ws.Repos {
+				if changes[repo], err = dry.developRepo(repo, repls); err != nil {
+					err = fmt.Errorf("%s: %s", repo, err)
+					break steps
+				}
+			}
+		case 2:
+			for _, repo := range ws.Repos {
+				c = append(c, changes[repo]...)
+			}
+			err = r.verifyBeforeWrite(c)
+		case 3:
+			if r.DryRun {
+				break
+			}
+			err = r.writeRepos(ws.Repos, changes, func(repo string) error {
+				if len(changes[repo]) == 0 {
+					return nil
+				}
+				return recordDevelop(repo, repls, changes[repo])
+			})
+		case 4:
+			err = r.verifyAfterWrite(c)
+		case 5:
+			ws.rename(c)
+		}
+	}
+	return
+}
+
+// developRepo computes the changes of the given replacements inside repo
+func (r *Rewriter) developRepo(repo string, repls []replaceFile) (Changes, error) {
+	pkg, err := Pkg(repo)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		deps  []string
+		repl  replacers
+		found []string
+	)
+
+	for _, rf := range repls {
+		repl = append(repl, rf)
+		if found, err = DependentsPrefix(repo, rf.gopkgin); err != nil {
+			return nil, err
+		}
+		deps = append(deps, found...)
+	}
+	return r.rewrite(repl, repls, repo, pkg.SrcRoot, deps)
+}
+
+// UndevelopWorkspace restores the paths that have been switched by DevelopWorkspace
+// inside every member repo that is in develop mode. Nothing is written, if the
+// paths can't be restored in one of the repos, and the repos written before are
+// restored, if a repo can't be written.
+func (r *Rewriter) UndevelopWorkspace(ws *Workspace) (c Changes, err error) {
+	var (
+		changes = map[string]Changes{}
+		dry     = *r
+		repos   []string
+	)
+	dry.DryRun = true
+	// the changes of all repos are verified together
+	dry.Verify = false
+
+steps:
+	for jump := 1; err == nil; jump++ {
+		switch jump - 1 {
+		default:
+			break steps
+		case 0:
+			for _, repo := range ws.Repos {
+				var s *DevelopState
+				if s, err = DevelopStatus(repo); err != nil {
+					break steps
+				}
+				if s != nil {
+					repos = append(repos, repo)
+				}
+			}
+		case 1:
+			for _, repo := range repos {
+				if changes[repo], err = dry.Undevelop(repo); err != nil {
+					err = fmt.Errorf("%s: %s", repo, err)
+					break steps
+				}
+			}
+		case 2:
+			for _, repo := range repos {
+				c = append(c, changes[repo]...)
+			}
+			err = r.verifyBeforeWrite(c)
+		case 3:
+			if r.DryRun {
+				break
+			}
+			err = r.writeRepos(repos, changes, leaveDevelop)
+		case 4:
+			err = r.verifyAfterWrite(c)
+		case 5:
+			ws.rename(c)
+		}
+	}
+	return
+}
+
+// writeRepos writes the changes of every repo and calls done for it afterwards.
+// If a repo fails, the repos that have been written before are restored together
+// with their develop state, so that the repos are switched all or nothing.
+func (r *Rewriter) writeRepos(repos []string, changes map[string]Changes, done func(repo string) error) (err error) {
+	var undo []undoStep
+
+	for _, repo := range repos {
+		var state []byte
+		if state, err = ioutil.ReadFile(developPath(repo)); err != nil && !os.IsNotExist(err) {
+			break
+		}
+		// the write of a single repo is undone by its journal
+		if err = r.write(repo, changes[repo]); err != nil {
+			err = fmt.Errorf("%s: %s", repo, err)
+			break
+		}
+		undo = append(undo, undoWrite(repo, changes[repo], state))
+		if err = done(repo); err != nil {
+			err = fmt.Errorf("%s: %s", repo, err)
+			break
+		}
+	}
+
+	if err != nil {
+		err = rollback(err, undo)
+	}
+	return
+}
+
+// undoWrite returns the step that restores the files of repo that have been changed
+// by c and the develop state, that is nil if there was none
+func undoWrite(repo string, c Changes, state []byte) undoStep {
+	return undoStep{desc: repo, fn: func() error {
+		inverse := make(Changes, len(c))
+		for i, f := range c {
+			inverse[i] = &FileChange{Path: f.Path, Original: f.Replaced, Replaced: f.Original}
+		}
+		if err := commit(repo, inverse); err != nil {
+			return err
+		}
+		if state == nil {
+			return leaveDevelop(repo)
+		}
+		return ioutil.WriteFile(developPath(repo), state, 0644)
+	}}
+}
@@ -0,0 +1,86 @@
+package gpk
+
+import (
+	"go/build"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadWorkspace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gpk-workspace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "gpk.workspace")
+	ioutil.WriteFile(file, []byte("# libs\nbuiltin\n\n../other/lib/\n/abs/repo\n"), 0644)
+
+	ws, err := ReadWorkspace(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		filepath.Join(dir, "builtin"),
+		filepath.Join(filepath.Dir(dir), "other", "lib"),
+		"/abs/repo",
+	}
+
+	if ws.Dir != dir || len(ws.Repos) != len(expected) {
+		t.Fatalf("ReadWorkspace() = %#v; want dir %#v and repos %#v", ws, dir, expected)
+	}
+
+	for i, repo := range ws.Repos {
+		if got, want := repo, expected[i]; got != want {
+			t.Errorf("ws.Repos[%d] = %#v; want %#v", i, got, want)
+		}
+	}
+}
+
+func TestDevelopWorkspaceRollback(t *testing.T) {
+	gopath, err := ioutil.TempDir("", "gpk-gopath")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(gopath)
+
+	defer func(p, mod string) {
+		build.Default.GOPATH = p
+		os.Setenv("GO111MODULE", mod)
+	}(build.Default.GOPATH, os.Getenv("GO111MODULE"))
+	build.Default.GOPATH = gopath
+	os.Setenv("GO111MODULE", "off")
+
+	var (
+		src   = filepath.Join(gopath, "src", "github.com", "a")
+		b     = filepath.Join(src, "b")
+		c     = filepath.Join(src, "c")
+		files = map[string]string{
+			"b/b.go": "package b\n\nimport _ \"gopkg.in/a/c.v1\"\n",
+			"c/c.go": "package c\n\nimport _ \"gopkg.in/a/b.v1\"\n",
+			// the write of c fails
+			"c/" + JournalFile: "{}",
+		}
+	)
+	writeFiles(t, src, files)
+
+	ws := &Workspace{Dir: src, Repos: []string{b, c}}
+	_, err = (&Rewriter{}).DevelopWorkspace(ws)
+	if err == nil || !strings.Contains(err.Error(), "(rolled back "+b+")") {
+		t.Fatalf("DevelopWorkspace() = %v; want the error of c and b rolled back", err)
+	}
+
+	if data, _ := ioutil.ReadFile(filepath.Join(b, "b.go")); string(data) != files["b/b.go"] {
+		t.Errorf("b.go = %#v; want it restored", string(data))
+	}
+	if s, err := DevelopStatus(b); s != nil || err != nil {
+		t.Errorf("DevelopStatus(b) = %#v, %v; want b not in develop mode", s, err)
+	}
+	if _, err := os.Stat(filepath.Join(b, JournalFile)); !os.IsNotExist(err) {
+		t.Errorf("b has a journal; want it removed")
+	}
+}